@@ -27,3 +27,14 @@ func (c *CI) CopyIntX(in IntStr, out *IntStr) error {
 	}
 	return nil
 }
+
+// TraceStr is a testing structure with a trace context envelope
+type TraceStr struct {
+	TraceParent string
+}
+
+// EchoTrace is a testing method
+func (c *CI) EchoTrace(in TraceStr, out *TraceStr) error {
+	out.TraceParent = in.TraceParent
+	return nil
+}
@@ -0,0 +1,101 @@
+package glick
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// RedactedToken replaces the Token of each Config returned by State().
+const RedactedToken = "REDACTED"
+
+// State describes the registered APIs, plugins and sub-processes of a Library.
+type State struct {
+	APIs       []APIState
+	ValidTypes []string       // the valid plugin type names for the configuration
+	SubProcs   []SubProcState // the local RPC servers started by StartLocalRPCservers()
+}
+
+// APIState describes a registered API and its plugins.
+type APIState struct {
+	API     string
+	In, Out string   // the types of the input and output prototypes
+	Timeout Duration // the maximum time a plugin for this API may take
+	Actions []ActionState
+	Rules   []Rule `json:",omitempty"` // the rules for rerouting calls, see RuleOverloader()
+}
+
+// ActionState describes the plugin registered for an action.
+type ActionState struct {
+	Action   string
+	Config   *Config   // the configuration of the plugin if any, with the Token redacted
+	Weighted []*Config `json:",omitempty"` // the configurations of all the weighted plugins, if more than one
+}
+
+// SubProcState describes a running local RPC server.
+type SubProcState struct {
+	Plugin string
+	Cmd    []string
+	Pid    int
+}
+
+// State returns a snapshot of the registered APIs, plugins and sub-processes of the library,
+// sorted by name.
+func (l *Library) State() State {
+	if l == nil {
+		return State{}
+	}
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	var st State
+	for api, def := range l.apim {
+		as := APIState{API: api, In: def.ppiT.String(), Out: def.ppoT.String(),
+			Timeout: Duration(def.timeout), Actions: []ActionState{}, Rules: l.rules[api]}
+		for k, pv := range l.pim {
+			if k.api == api {
+				acs := ActionState{Action: k.action, Config: redact(pv.cfg)}
+				for _, v := range pv.weighted {
+					acs.Weighted = append(acs.Weighted, redact(v.cfg))
+				}
+				as.Actions = append(as.Actions, acs)
+			}
+		}
+		sort.Slice(as.Actions, func(i, j int) bool { return as.Actions[i].Action < as.Actions[j].Action })
+		st.APIs = append(st.APIs, as)
+	}
+	sort.Slice(st.APIs, func(i, j int) bool { return st.APIs[i].API < st.APIs[j].API })
+	st.ValidTypes = l.ValidTypes()
+	sort.Strings(st.ValidTypes)
+	for _, s := range l.subprocs {
+		st.SubProcs = append(st.SubProcs, SubProcState{Plugin: s.plugin, Cmd: s.cmd, Pid: s.ecmd.Process.Pid})
+	}
+	return st
+}
+
+// redact returns a copy of a Config with any Token replaced.
+func redact(cfg *Config) *Config {
+	if cfg == nil {
+		return nil
+	}
+	cp := *cfg
+	if cp.Token != "" {
+		cp.Token = RedactedToken
+	}
+	return &cp
+}
+
+// AdminHandler returns an http.Handler which serves the State() of the library as JSON,
+// so that it is possible to see which plugin serves which action at runtime.
+func (l *Library) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.MarshalIndent(l.State(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(b); err != nil {
+			return // nothing more can be done
+		}
+	})
+}
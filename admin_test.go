@@ -0,0 +1,81 @@
+package glick_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+	test "github.com/documize/glick/_test"
+)
+
+func TestAdmin(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var is test.IntStr
+	outProtoInt := func() interface{} { var i int; return interface{}(&i) }
+	if err := l.RegAPI("test", is, outProtoInt, time.Second); err != nil {
+		t.Error(err)
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, 2*time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "go", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"sleeper","API":"test","Actions":["nap","doze"],"Type":"RPC","Path":"localhost:4243",
+ "Method":"foo.bar","Cmd":["sleep","60"],"Token":"SECRET"}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if err := l.StartLocalRPCservers(ioutil.Discard, ioutil.Discard); err != nil {
+		t.Error(err)
+	}
+	defer l.KillSubProcs()
+
+	rec := httptest.NewRecorder()
+	l.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/admin", nil))
+	b, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Contains(string(b), "SECRET") {
+		t.Error("token not redacted")
+	}
+	var st glick.State
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(st.APIs) != 2 {
+		t.Errorf("wrong apis %#v", st.APIs)
+		return
+	}
+	if a := st.APIs[0]; a.API != "abc" || a.In != "int" || a.Out != "*bool" ||
+		time.Duration(a.Timeout) != 2*time.Second || len(a.Actions) != 1 ||
+		a.Actions[0].Action != "go" || a.Actions[0].Config != nil {
+		t.Errorf("wrong api state %#v", a)
+	}
+	if a := st.APIs[1]; a.API != "test" || a.In != "test.IntStr" || len(a.Actions) != 2 ||
+		a.Actions[0].Action != "doze" || a.Actions[1].Config == nil ||
+		a.Actions[1].Config.Plugin != "sleeper" || a.Actions[1].Config.Token != glick.RedactedToken {
+		t.Errorf("wrong api state %#v", a)
+	}
+	if strings.Join(st.ValidTypes, ",") != "CMD,RPC,URL" {
+		t.Errorf("wrong valid types %v", st.ValidTypes)
+	}
+	if len(st.SubProcs) != 1 || st.SubProcs[0].Plugin != "sleeper" || st.SubProcs[0].Pid == 0 {
+		t.Errorf("wrong sub-processes %#v", st.SubProcs)
+	}
+	if l.Token("test", "nap") != "SECRET" {
+		t.Error("token changed by redaction")
+	}
+}
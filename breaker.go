@@ -0,0 +1,217 @@
+package glick
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The states of a circuit breaker.
+const (
+	BreakerClosed   = "closed"    // calls are passed to the plugin
+	BreakerOpen     = "open"      // calls fail fast, without calling the plugin
+	BreakerHalfOpen = "half-open" // a single call is passed to the plugin to probe if it has recovered
+)
+
+// BreakerPolicy describes when the circuit breaker for a plugin opens.
+type BreakerPolicy struct {
+	FailureRate float64  // the fraction of calls failing, from 0 to 1, which opens the breaker.
+	MinCalls    int      // the least number of calls in the window before the breaker may open.
+	Window      Duration // the period over which the failure rate is measured, default one minute.
+	OpenFor     Duration // how long the breaker stays open before probing the plugin, default 30 seconds.
+}
+
+// Breaker sets the BreakerPolicy for every action on an API,
+// a BreakerPolicy in the Config of a plugin overrides it.
+func Breaker(bp BreakerPolicy) APIOption {
+	return func(def *apidef) error {
+		if err := bp.validate(); err != nil {
+			return err
+		}
+		def.breaker = &bp
+		return nil
+	}
+}
+
+func (bp *BreakerPolicy) validate() error {
+	if bp.FailureRate <= 0 || bp.FailureRate > 1 {
+		return errors.New("breaker policy failure rate must be above 0 and at most 1")
+	}
+	if bp.MinCalls < 0 || bp.Window < 0 || bp.OpenFor < 0 {
+		return errors.New("negative breaker policy value")
+	}
+	return nil
+}
+
+func (bp *BreakerPolicy) window() time.Duration {
+	if bp.Window == 0 {
+		return time.Minute
+	}
+	return time.Duration(bp.Window)
+}
+
+func (bp *BreakerPolicy) openFor() time.Duration {
+	if bp.OpenFor == 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(bp.OpenFor)
+}
+
+// BreakerOpenError is returned, without running the plugin,
+// while the circuit breaker for an api/action is open.
+type BreakerOpenError struct {
+	API, Action string
+	Until       time.Time // when the breaker will next let a call through to probe the plugin
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for api %s action %s until %s",
+		e.API, e.Action, e.Until.Format(time.RFC3339))
+}
+
+// BreakerState describes the circuit breaker for an api/action.
+type BreakerState struct {
+	API, Action string
+	Variant     int       // the index of the plugin among the weighted plugins for the api/action
+	State       string    // one of BreakerClosed, BreakerOpen or BreakerHalfOpen
+	Calls       int       // the number of calls in the current window
+	Failures    int       // the number of those calls which failed
+	Until       time.Time // when an open breaker will next let a call through
+}
+
+// breaker holds the running state of a circuit breaker.
+type breaker struct {
+	mtx     sync.Mutex
+	state   string
+	start   time.Time // the start of the current window
+	calls   int
+	fails   int
+	until   time.Time
+	probing bool   // a probe call is running in the half-open state
+	gen     uint64 // changed with the state, so that calls only record outcomes for the state they started in
+}
+
+// breaker returns the circuit breaker for a plugin, creating it if required.
+// Each of the weighted plugins for an api/action has its own circuit breaker.
+func (l *Library) breaker(key healthKey) *breaker {
+	l.bmtx.Lock()
+	defer l.bmtx.Unlock()
+	b, found := l.breakers[key]
+	if !found {
+		b = &breaker{state: BreakerClosed, start: time.Now()}
+		l.breakers[key] = b
+	}
+	return b
+}
+
+// forgetBreaker removes the circuit breakers of the plugins for an api/action which has been replaced.
+func (l *Library) forgetBreaker(key plugkey) {
+	l.bmtx.Lock()
+	for bk := range l.breakers {
+		if bk.plugkey == key {
+			delete(l.breakers, bk)
+		}
+	}
+	l.bmtx.Unlock()
+}
+
+// allow returns an error if the call should not go ahead,
+// otherwise the generation of the breaker to give to record().
+func (b *breaker) allow(api, action string) (uint64, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.state == BreakerOpen {
+		if time.Now().Before(b.until) {
+			return 0, &BreakerOpenError{API: api, Action: action, Until: b.until}
+		}
+		b.state = BreakerHalfOpen
+		b.probing = false
+		b.gen++
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probing {
+			return 0, &BreakerOpenError{API: api, Action: action, Until: b.until}
+		}
+		b.probing = true
+	}
+	return b.gen, nil
+}
+
+// record the outcome of a call, a call cancelled by the caller is not counted.
+// Calls which started before the state of the breaker changed are ignored,
+// so that only the probe call decides the outcome of the half-open state.
+func (b *breaker) record(gen uint64, bp *BreakerPolicy, failed, cancelled bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if gen != b.gen {
+		return
+	}
+	now := time.Now()
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		switch {
+		case cancelled:
+		case failed:
+			b.trip(now, bp)
+		default:
+			b.state = BreakerClosed
+			b.gen++
+			b.reset(now)
+		}
+		return
+	}
+	if cancelled {
+		return
+	}
+	if now.Sub(b.start) > bp.window() {
+		b.reset(now)
+	}
+	b.calls++
+	if failed {
+		b.fails++
+	}
+	if b.calls >= bp.MinCalls && float64(b.fails) >= bp.FailureRate*float64(b.calls) {
+		b.trip(now, bp)
+	}
+}
+
+func (b *breaker) trip(now time.Time, bp *BreakerPolicy) {
+	b.state = BreakerOpen
+	b.gen++
+	b.until = now.Add(bp.openFor())
+	b.reset(now)
+}
+
+func (b *breaker) reset(now time.Time) {
+	b.start = now
+	b.calls, b.fails = 0, 0
+}
+
+// Breakers returns the state of every circuit breaker in use, sorted by api, action and variant.
+func (l *Library) Breakers() []BreakerState {
+	if l == nil {
+		return nil
+	}
+	l.bmtx.Lock()
+	defer l.bmtx.Unlock()
+	ret := make([]BreakerState, 0, len(l.breakers))
+	for k, b := range l.breakers {
+		b.mtx.Lock()
+		ret = append(ret, BreakerState{API: k.api, Action: k.action, Variant: k.variant, State: b.state,
+			Calls: b.calls, Failures: b.fails, Until: b.until})
+		b.mtx.Unlock()
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].API != ret[j].API {
+			return ret[i].API < ret[j].API
+		}
+		if ret[i].Action != ret[j].Action {
+			return ret[i].Action < ret[j].Action
+		}
+		return ret[i].Variant < ret[j].Variant
+	})
+	return ret
+}
@@ -0,0 +1,197 @@
+package glick_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestBreaker(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("bad", prototype, outTov, time.Second,
+		glick.Breaker(glick.BreakerPolicy{})); err == nil {
+		t.Error("zero failure rate not spotted")
+	}
+	if err := l.RegAPI("abc", prototype, outTov, 50*time.Millisecond,
+		glick.Breaker(glick.BreakerPolicy{FailureRate: 0.5, MinCalls: 2,
+			OpenFor: glick.Duration(50 * time.Millisecond)})); err != nil {
+		t.Error(err)
+		return
+	}
+	plug, calls := flaky(3)
+	if err := l.RegPlugin("abc", "flaky", plug, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "forever", Forever, nil); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := l.Run(nil, "abc", "flaky", 1); err == nil {
+			t.Error("flaky plugin did not fail")
+		}
+	}
+	_, err := l.Run(nil, "abc", "flaky", 1)
+	if _, open := err.(*glick.BreakerOpenError); !open || calls() != 2 {
+		t.Error("breaker did not open", err, calls())
+	}
+	if bs := l.Breakers(); len(bs) != 1 || bs[0].Action != "flaky" || bs[0].State != glick.BreakerOpen {
+		t.Errorf("wrong breaker state %#v", bs)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := l.Run(nil, "abc", "flaky", 1); err == nil || calls() != 3 {
+		t.Error("half-open breaker did not probe", err, calls())
+	}
+	if _, err := l.Run(nil, "abc", "flaky", 1); err == nil || calls() != 3 {
+		t.Error("failed probe did not re-open breaker", err, calls())
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := l.Run(nil, "abc", "flaky", 1); err != nil || calls() != 4 {
+		t.Error("breaker did not close after successful probe", err, calls())
+	}
+	if bs := l.Breakers(); bs[0].State != glick.BreakerClosed {
+		t.Errorf("wrong breaker state %#v", bs)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := l.Run(nil, "abc", "forever", 1); err == nil {
+			t.Error("forever plugin did not time-out")
+		}
+	}
+	start := time.Now()
+	if _, err := l.Run(nil, "abc", "forever", 1); err == nil || time.Since(start) > 10*time.Millisecond {
+		t.Error("open breaker did not fail fast", err)
+	}
+}
+
+func TestBreakerConfig(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p1","API":"string/*string","Actions":["exit1"],"Type":"CMD","Cmd":["bash","./_test/exit1.sh"],
+ "Breaker":{"FailureRate":1,"OpenFor":"1m"}}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "string/*string", "exit1", ""); err == nil {
+		t.Error("exit1.sh does not give an error")
+	}
+	if _, err := l.Run(nil, "string/*string", "exit1", ""); err == nil {
+		t.Error("no error from open breaker")
+	} else if _, open := err.(*glick.BreakerOpenError); !open {
+		t.Error("configured breaker did not open", err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p2","API":"string/*string","Actions":["bad"],"Type":"CMD","Cmd":["pwd"],"Breaker":{"FailureRate":2}}
+		]`)); err == nil {
+		t.Error("bad breaker policy not spotted")
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second,
+		glick.Breaker(glick.BreakerPolicy{FailureRate: 0.5, MinCalls: 2,
+			OpenFor: glick.Duration(20 * time.Millisecond)})); err != nil {
+		t.Error(err)
+		return
+	}
+	slow, probe := make(chan struct{}), make(chan struct{})
+	if err := l.RegPlugin("abc", "act", func(ctx context.Context, in interface{}) (interface{}, error) {
+		switch in.(int) {
+		case 2:
+			<-slow
+			return Tov(ctx, in)
+		case 3:
+			<-probe
+		}
+		return nil, errors.New("failed")
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	state := func() string { return l.Breakers()[0].State }
+	var wg sync.WaitGroup
+	run := func(in int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Run(nil, "abc", "act", in); err == nil && in != 2 {
+				t.Error("no error")
+			}
+		}()
+	}
+	run(2) // started while the breaker is closed
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := l.Run(nil, "abc", "act", 1); err == nil {
+			t.Error("no error")
+		}
+	}
+	if s := state(); s != glick.BreakerOpen {
+		t.Fatalf("breaker %s, wanted open", s)
+	}
+	time.Sleep(30 * time.Millisecond)
+	run(3) // the half-open probe
+	time.Sleep(10 * time.Millisecond)
+	close(slow)
+	time.Sleep(10 * time.Millisecond)
+	if s := state(); s != glick.BreakerHalfOpen {
+		t.Errorf("breaker %s after an older call succeeded, wanted half-open", s)
+	}
+	close(probe)
+	wg.Wait()
+	if s := state(); s != glick.BreakerOpen {
+		t.Errorf("breaker %s after the probe failed, wanted open", s)
+	}
+}
+
+func TestBreakerReregister(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second,
+		glick.Breaker(glick.BreakerPolicy{FailureRate: 0.5, MinCalls: 1,
+			OpenFor: glick.Duration(time.Hour)})); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "fixed", JustBad, nil); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := l.Run(nil, "abc", "fixed", 1); err == nil {
+			t.Error("bad plugin did not fail")
+		}
+	}
+	if bs := l.Breakers(); len(bs) != 1 || bs[0].State != glick.BreakerOpen {
+		t.Errorf("breaker not open %#v", bs)
+	}
+	if err := l.RegPlugin("abc", "fixed", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "abc", "fixed", 1); err != nil {
+		t.Error("breaker of the replaced plugin still applied", err)
+	}
+}
@@ -0,0 +1,129 @@
+package glick
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// CachePolicy describes how the results of calls to plugins are cached.
+// Only successful results are cached, keyed by api, action and a hash of the JSON encoding
+// of the input; calls re-routed by the overloader are not cached.
+// Cached outputs are shared between callers, so must not be modified.
+type CachePolicy struct {
+	TTL     Duration // how long a result is kept.
+	MaxSize int      // the most results kept, the least recently used are removed first.
+}
+
+// Cache sets the CachePolicy for every action on an API,
+// a CachePolicy in the Config of a plugin overrides it.
+func Cache(cp CachePolicy) APIOption {
+	return func(def *apidef) error {
+		c, err := newCache(cp)
+		if err != nil {
+			return err
+		}
+		def.cache = c
+		return nil
+	}
+}
+
+type noCacheKey struct{}
+
+// NoCache returns a context for which Run() does not use cached results,
+// although the results of the call are still cached.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// cache holds the results of calls in least recently used order.
+type cache struct {
+	policy CachePolicy
+	mtx    sync.Mutex
+	lru    *list.List // of *cached, most recently used at the front
+	items  map[string]*list.Element
+}
+
+type cached struct {
+	key     string
+	out     interface{}
+	expires time.Time
+}
+
+func newCache(cp CachePolicy) (*cache, error) {
+	if cp.TTL <= 0 || cp.MaxSize <= 0 {
+		return nil, errors.New("cache policy TTL and MaxSize must be positive")
+	}
+	return &cache{policy: cp, lru: list.New(), items: make(map[string]*list.Element)}, nil
+}
+
+// cacheKey returns the key for a call, or false if the input cannot be encoded.
+func cacheKey(api, action string, in interface{}) (string, bool) {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.Sum256(b)
+	return api + "\x00" + action + "\x00" + string(h[:]), true
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	e, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+	item := e.Value.(*cached)
+	if time.Now().After(item.expires) {
+		c.lru.Remove(e)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return item.out, true
+}
+
+func (c *cache) put(key string, out interface{}) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	item := &cached{key: key, out: out, expires: time.Now().Add(time.Duration(c.policy.TTL))}
+	if e, found := c.items[key]; found {
+		e.Value = item
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.lru.PushFront(item)
+	for c.lru.Len() > c.policy.MaxSize {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.items, e.Value.(*cached).key)
+	}
+}
+
+// cache returns the cache to use for a call and its key, if the call may be cached.
+func (c call) cache() (*cache, string, bool) {
+	ch := c.pv.cache
+	if ch == nil {
+		ch = c.def.cache
+	}
+	if ch == nil || c.overloaded {
+		return nil, "", false
+	}
+	key, ok := cacheKey(c.api, c.action, c.in)
+	if !ok {
+		return nil, "", false
+	}
+	return ch, key, true
+}
+
+// useCache returns true unless the context says not to use cached results.
+func useCache(ctx context.Context) bool {
+	no, _ := ctx.Value(noCacheKey{}).(bool)
+	return !no
+}
@@ -0,0 +1,102 @@
+package glick_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestCache(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("bad", 1, outTov, time.Second,
+		glick.Cache(glick.CachePolicy{})); err == nil {
+		t.Error("empty cache policy not spotted")
+	}
+	if err := l.RegAPI("cache", 1, outTov, time.Second,
+		glick.Cache(glick.CachePolicy{TTL: glick.Duration(time.Hour), MaxSize: 2})); err != nil {
+		t.Error(err)
+	}
+	calls := 0
+	count := func(ctx context.Context, in interface{}) (interface{}, error) {
+		calls++
+		return Tov(ctx, in)
+	}
+	if err := l.RegPlugin("cache", "count", count, nil); err != nil {
+		t.Error(err)
+	}
+	run := func(ctx context.Context, in int, want int) {
+		if _, err := l.Run(ctx, "cache", "count", in); err != nil {
+			t.Error(err)
+		}
+		if calls != want {
+			t.Errorf("calls %d, wanted %d", calls, want)
+		}
+	}
+	run(nil, 1, 1)
+	run(nil, 1, 1)
+	run(nil, 2, 2)
+	run(glick.NoCache(context.Background()), 1, 3)
+	run(nil, 3, 4) // evicts 2, the least recently used
+	run(nil, 1, 4)
+	run(nil, 2, 5)
+
+	if err := l.RegPlugin("cache", "bad", JustBad, nil); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := l.Run(nil, "cache", "bad", 1); err == nil {
+			t.Error("error result was cached")
+		}
+	}
+
+	if err := l.RegPlugin("cache", "badCfg", Tov, &glick.Config{
+		Cache: &glick.CachePolicy{MaxSize: 10},
+	}); err == nil {
+		t.Error("bad cache config not spotted")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("cache", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("cache", "count", Tov, &glick.Config{
+		Cache: &glick.CachePolicy{TTL: glick.Duration(10 * time.Millisecond), MaxSize: 10},
+	}); err != nil {
+		t.Error(err)
+	}
+	calls := 0
+	if err := l.Use(func(api, action string, handler glick.Plugin) glick.Plugin {
+		return func(ctx context.Context, in interface{}) (interface{}, error) {
+			calls++
+			return handler(ctx, in)
+		}
+	}); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := l.Run(nil, "cache", "count", 1); err != nil {
+			t.Error(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("calls %d, wanted 1", calls)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := l.Run(nil, "cache", "count", 1); err != nil {
+		t.Error(err)
+	}
+	if calls != 2 {
+		t.Errorf("calls %d after TTL, wanted 2", calls)
+	}
+}
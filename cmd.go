@@ -4,20 +4,19 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
-	"sync"
 
 	"golang.org/x/net/context"
 )
 
-var cmdmtx sync.Mutex // ensure we only run one command at a time, across the system
-
 // PluginCmd only works with an api with a simple Text/Text signature.
 // it runs the given operating system command using the input string
 // as stdin and putting stdout into the output string.
-// At present, to limit stress on system resources,
-// only one os command can run at a time via this plugin sub-system.
+// To limit stress on system resources, set how many commands may run at once
+// using the Limit field of the Config, the Limit() option of the API or the GlobalLimit() option of the Library.
+// Any traceparent in the context is passed to the command in the TRACEPARENT environment variable.
 func PluginCmd(cmd []string, model interface{}) Plugin {
 	if len(cmd) == 0 {
 		return nil
@@ -28,9 +27,10 @@ func PluginCmd(cmd []string, model interface{}) Plugin {
 	}
 	return func(ctx context.Context, in interface{}) (interface{}, error) {
 		var err error
-		cmdmtx.Lock()
-		defer cmdmtx.Unlock()
 		ecmd := exec.Command(cmdPath, cmd[1:]...)
+		if tp := TraceParent(ctx); tp != "" {
+			ecmd.Env = append(os.Environ(), TraceParentEnv+"="+tp)
+		}
 		ecmd.Stdin, err = TextReader(in)
 		if err != nil {
 			return nil, err
@@ -80,6 +80,10 @@ func ConfigCmd(lib *Library) error {
 				return fmt.Errorf("entry %d CMD register plugin error: %v",
 					line, err)
 			}
+			if err := l.RegProbe(cfg.API, action, ProbeCmd(cfg.Cmd[0])); err != nil {
+				return fmt.Errorf("entry %d CMD register probe error: %v",
+					line, err)
+			}
 		}
 		return nil
 	})
@@ -0,0 +1,101 @@
+package glick
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Coalesce makes identical calls to an API, with the same action and input, share one call to the plugin
+// while it is in flight. Each caller still gives up when its own context is done,
+// the shared call is only cancelled once every caller has given up.
+// Inputs which cannot be encoded as JSON, and calls re-routed by the overloader, are not coalesced,
+// nor are calls with a different timeout, see WithPluginTimeout(), or rate limited for a different identity.
+func Coalesce() APIOption {
+	return func(def *apidef) error {
+		def.flights = &flights{m: make(map[string]*flight)}
+		return nil
+	}
+}
+
+// flights holds the calls in flight for an API.
+type flights struct {
+	mtx sync.Mutex
+	m   map[string]*flight
+}
+
+// flight is a call shared by one or more callers.
+type flight struct {
+	done    chan struct{} // closed when out and err are set
+	out     interface{}
+	err     error
+	waiting int // the number of callers still waiting
+	cancel  context.CancelFunc
+}
+
+// detached keeps the values of a context, but not its deadline or cancellation.
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// do runs the call, unless an identical call is already in flight, in which case it waits for that result.
+func (fs *flights) do(ctx context.Context, key string, call func(context.Context) (interface{}, error)) (interface{}, error) {
+	fs.mtx.Lock()
+	f, found := fs.m[key]
+	if !found {
+		fctx, cancel := context.WithCancel(detached{ctx})
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		fs.m[key] = f
+		go func() {
+			f.out, f.err = call(fctx)
+			fs.mtx.Lock()
+			if fs.m[key] == f {
+				delete(fs.m, key)
+			}
+			fs.mtx.Unlock()
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiting++
+	fs.mtx.Unlock()
+
+	select {
+	case <-f.done:
+		return f.out, f.err
+	case <-ctx.Done():
+		fs.mtx.Lock()
+		f.waiting--
+		if f.waiting == 0 {
+			if fs.m[key] == f {
+				delete(fs.m, key) // later callers should not share a cancelled call
+			}
+			f.cancel()
+		}
+		fs.mtx.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// flightKey returns the key which identical calls in flight share, if the input can be encoded.
+// The calls must also have the same timeout, weighted plugin, and identity if rate limited by it,
+// as the shared call runs with the context of the first caller.
+func (l *Library) flightKey(ctx context.Context, c call) (string, bool) {
+	key, ok := cacheKey(c.api, c.action, c.in)
+	if !ok {
+		return "", false
+	}
+	key += "\x00" + c.timeout(ctx).String() + "\x00" + strconv.Itoa(c.pv.variant)
+	rp := c.pv.rate
+	if rp == nil {
+		rp = c.def.rate
+	}
+	if rp != nil && rp.By == RateByIdentity && l.identity != nil {
+		key += "\x00" + l.identity(ctx)
+	}
+	return key, true
+}
@@ -0,0 +1,97 @@
+package glick_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestCoalesce(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("coalesce", 1, outTov, time.Second, glick.Coalesce()); err != nil {
+		t.Error(err)
+	}
+	var calls int32
+	slow := func(ctx context.Context, in interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return Tov(ctx, in)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := l.RegPlugin("coalesce", "slow", slow, nil); err != nil {
+		t.Error(err)
+	}
+	if errs := runMany(l, "coalesce", "slow", 20); errs != 0 {
+		t.Errorf("%d errors from coalesced calls", errs)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("%d calls to the plugin, wanted 1", n)
+	}
+
+	// a caller giving up does not cancel the call for the others
+	atomic.StoreInt32(&calls, 0)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := l.Run(nil, "coalesce", "slow", 2); err != nil {
+			t.Error(err)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Run(ctx, "coalesce", "slow", 2); err != context.DeadlineExceeded {
+		t.Error("cancelled caller did not give up", err)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("%d calls to the plugin, wanted 1", n)
+	}
+
+	// different inputs are not coalesced
+	atomic.StoreInt32(&calls, 0)
+	wg.Add(2)
+	for i := 3; i < 5; i++ {
+		go func(i int) {
+			defer wg.Done()
+			if _, err := l.Run(nil, "coalesce", "slow", i); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("%d calls to the plugin, wanted 2", n)
+	}
+
+	// a caller with a shorter timeout does not impose it on the others
+	atomic.StoreInt32(&calls, 0)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		short := glick.WithPluginTimeout(context.Background(), 20*time.Millisecond)
+		if _, err := l.Run(short, "coalesce", "slow", 5); err != context.DeadlineExceeded {
+			t.Error("short timeout not applied", err)
+		}
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := l.Run(nil, "coalesce", "slow", 5); err != nil {
+		t.Error("timeout of another caller applied", err)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("%d calls to the plugin, wanted 2", n)
+	}
+}
@@ -6,31 +6,101 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config defines a line in the JSON configuration file for a glick Libarary.
 type Config struct {
-	Plugin  string   // name of the plugin server, used to configure URL ports.
-	API     string   // must already exist.
-	Actions []string // these must be unique within the API.
-	Token   string   // authorisation string to pass in the API, if it contains a Token field.
-	Type    string   // the type of plugin, e.g. "RPC","URL","CMD"...
-	Method  string   // the service method to use in the plugin, if relavent.
-	Path    string   // path to the end-point for "RPC" or "URL".
-	Cmd     []string // command to run to start an image in "CMD", or to start a local "RPC" server.
-	Comment string   // a place to put comments about the entry.
+	Plugin     string   // name of the plugin server, used to configure URL ports.
+	API        string   // must already exist, or be a version constraint, see VersionSep.
+	Actions    []string // these must be unique within the API.
+	Token      string   // authorisation string to pass in the API, if it contains a Token field.
+	Type       string   // the type of plugin, e.g. "RPC","URL","CMD"...
+	Method     string   // the service method to use in the plugin, if relavent.
+	Path       string   // path to the end-point for "RPC" or "URL".
+	HealthPath string   // path, relative to Path, to check the health of "URL" or "KIT" plugins.
+	Cmd        []string // command to run to start an image in "CMD", or to start a local "RPC" server.
+	Comment    string   // a place to put comments about the entry.
+
+	Fallback   []string       // actions on the same API to try in order, if the plugin fails.
+	FallbackOn []string       // the error classes which cause a fallback: "timeout","dial","unavailable" or "any" (the default).
+	Retry      *RetryPolicy   // how to retry the plugin if it fails, overriding any policy for the API.
+	Breaker    *BreakerPolicy // when to stop calling the plugin, overriding any policy for the API.
+	Timeout    Duration       // the maximum time the plugin may take, overriding the timeout of the API.
+	Limit      int            // the most calls to the plugin, across all its actions, that may run at once, 0 for no limit.
+	Weight     int            // the share of calls to the actions taken by the plugin, alongside other weighted plugins; 0 replaces them.
+	Rate       *RatePolicy    // how often the plugin may be called, overriding any policy for the API.
+	Cache      *CachePolicy   // how the results of the plugin are cached, overriding any policy for the API.
+	Rules      []Rule         // rules for rerouting calls to the API, see RuleOverloader().
+	Shadow     *ShadowPolicy  // another action to mirror calls to, to compare its results.
 
 	// bools at the end to make the structure smaller
 	Disabled bool // disable the plugin(s) or plugin server by setting this to true.
 	Gob      bool // should the plugin use GOB encoding rather than JSON, if relavent.
 	Static   bool // only used by "URL" to signal a static address.
+
+	sem chan struct{} // limits how many calls to the plugin run at once, set from Limit
+}
+
+// Duration is a time.Duration given in the JSON configuration as a string, such as "1.5s".
+type Duration time.Duration
+
+// UnmarshalJSON accepts a string in the format of time.ParseDuration(), or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return err
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON gives the Duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
 }
 
 // Configurator is a type of function that allows plug-in fuctionality to the Config process.
+// It is passed a staged copy of the library, which is discarded if any entry is in error,
+// so anything it starts, such as a process, should be undone by a function given to OnDiscard().
 type Configurator func(lib *Library, line int, cfg *Config) error
 
+// OnDiscard adds a function to call if the staged configuration passed to a Configurator is discarded.
+// Outside of a Configurator, the function is never called.
+func (l *Library) OnDiscard(fn func()) {
+	if l == nil || fn == nil {
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.touched != nil {
+		l.discards = append(l.discards, fn)
+	}
+}
+
+// discard calls the functions given to OnDiscard() while staging a configuration, latest first.
+func (l *Library) discard() {
+	l.mtx.Lock()
+	fns := l.discards
+	l.discards = nil
+	l.mtx.Unlock()
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
+
 // AddConfigurator adds a type of configuration to the library.
 func (l *Library) AddConfigurator(name string, cfg Configurator) error {
 	if l == nil {
@@ -52,9 +122,24 @@ func (l *Library) AddConfigurator(name string, cfg Configurator) error {
 func (l *Library) Disable(api string, actions []string) {
 	l.mtx.Lock()
 	for _, act := range actions {
-		delete(l.pim, plugkey{api: api, action: act})
+		key := plugkey{api: api, action: act}
+		delete(l.pim, key)
+		l.registered(key)
 	}
 	l.mtx.Unlock()
+	for _, act := range actions {
+		l.emit(Event{Kind: EventDisable, API: api, Action: act})
+	}
+}
+
+// registered records that a plugin has been changed, must be called with the library locked.
+// When staging a configuration the change is noted, otherwise the change becomes part of
+// the base set-up that a later Reconfigure() returns to.
+func (l *Library) registered(key plugkey) {
+	if l.touched != nil {
+		l.touched[key] = struct{}{}
+	}
+	delete(l.base, key)
 }
 
 // ValidTypes returns all the valid plugin type names.
@@ -67,6 +152,7 @@ func (l *Library) ValidTypes() []string {
 }
 
 // Configure takes a JSON-encoded byte slice and configures the plugins for a library from it.
+// The configuration is applied in one step, if any entry is in error nothing is changed.
 // NOTE: duplicate actions overload earlier versions.
 func (l *Library) Configure(b []byte) error {
 	if l == nil {
@@ -74,9 +160,173 @@ func (l *Library) Configure(b []byte) error {
 	}
 	var m []Config
 	if err := json.Unmarshal(b, &m); err != nil {
+		l.emit(Event{Kind: EventConfigure, Err: err})
+		return err
+	}
+	return l.configure(m, false)
+}
+
+// Reconfigure takes a JSON-encoded byte slice and replaces the current configuration
+// of the plugins for a library with it, in one step.
+// Plugins set-up by earlier configurations but not in this one are removed,
+// returning any plugins they overloaded or disabled to how they were before.
+// Local RPC servers, started by StartLocalRPCservers(), that are no longer
+// referenced by the new configuration are stopped.
+func (l *Library) Reconfigure(b []byte) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	var m []Config
+	if err := json.Unmarshal(b, &m); err != nil {
+		l.emit(Event{Kind: EventConfigure, Replace: true, Err: err})
 		return err
 	}
+	if err := l.configure(m, true); err != nil {
+		return err
+	}
+	return l.stopUnusedRPCservers()
+}
+
+// configure applies the configuration to a staged copy of the plugins,
+// then swaps it into the library, emitting an Event for each plugin changed.
+// If replace is set, the plugins changed by earlier configurations are first reset.
+// The Configurators run without the library locked, so calls to plugins carry on meanwhile.
+func (l *Library) configure(m []Config, replace bool) error {
+	evs, err := l.configureStaged(m, replace)
+	for _, ev := range evs {
+		l.emit(ev)
+	}
+	l.emit(Event{Kind: EventConfigure, Replace: replace, Entries: len(m), Err: err})
+	return err
+}
+
+func (l *Library) configureStaged(m []Config, replace bool) ([]Event, error) {
+	l.mtx.Lock()
+	stage := l.stage(l.start(replace))
+	l.mtx.Unlock()
+	if err := stage.apply(m); err != nil {
+		stage.discard()
+		return nil, err
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	// the plugins may have changed while staging, so only the changes made by the stage are applied
+	start := l.start(replace)
+	pim := make(plugmap, len(start))
+	for k, v := range start {
+		pim[k] = v
+	}
+	base := l.base
+	if replace {
+		base = make(plugmap)
+	}
+	var evs []Event
+	for k := range stage.touched {
+		l.forgetHealth(k)
+		l.forgetPanics(k)
+		l.forgetBreaker(k)
+		if _, had := base[k]; !had {
+			base[k] = start[k] // the zero plugval if there was none
+		}
+		if pv, found := stage.pim[k]; found {
+			pim[k] = pv
+			_, overload := l.pim[k]
+			evs = append(evs, Event{Kind: EventRegPlugin, API: k.api, Action: k.action,
+				Overload: overload, Config: redact(pv.cfg)})
+		} else {
+			delete(pim, k)
+			evs = append(evs, Event{Kind: EventDisable, API: k.api, Action: k.action})
+		}
+	}
+	if replace { // plugins returned to their base set-up
+		for k, v := range l.base {
+			if _, touched := stage.touched[k]; touched {
+				continue
+			}
+			if v.plug != nil {
+				evs = append(evs, Event{Kind: EventRegPlugin, API: k.api, Action: k.action,
+					Overload: true, Config: redact(v.cfg)})
+			} else {
+				evs = append(evs, Event{Kind: EventDisable, API: k.api, Action: k.action})
+			}
+		}
+	}
+	sort.Slice(evs, func(i, j int) bool {
+		if evs[i].API != evs[j].API {
+			return evs[i].API < evs[j].API
+		}
+		return evs[i].Action < evs[j].Action
+	})
+	l.pim, l.base = pim, base
+	if replace {
+		l.rules = stage.rules
+	} else {
+		for api, rs := range stage.rules {
+			if l.rules == nil {
+				l.rules = make(map[string][]Rule)
+			}
+			l.rules[api] = rs // the rules for an API replace those from before
+		}
+	}
+	return evs, nil
+}
+
+// start returns a copy of the plugins for a configuration to change,
+// if replace is set the plugins changed by earlier configurations are reset.
+// It must be called with the library locked.
+func (l *Library) start(replace bool) plugmap {
+	start := make(plugmap, len(l.pim))
+	for k, v := range l.pim {
+		start[k] = v
+	}
+	if replace {
+		for k, v := range l.base {
+			if v.plug == nil {
+				delete(start, k)
+			} else {
+				start[k] = v
+			}
+		}
+	}
+	return start
+}
+
+// stage returns a copy of the library, with its own copy of the plugins given,
+// which the Configurators can change without affecting running plugins.
+// It must be called with the library locked.
+func (l *Library) stage(pim plugmap) *Library {
+	s := &Library{
+		pim:     make(plugmap, len(pim)),
+		apim:    make(apimap, len(l.apim)),
+		cfgm:    make(cfgmap, len(l.cfgm)),
+		ovfn:    l.ovfn,
+		ctxkeys: l.ctxkeys,
+		touched: make(map[plugkey]struct{}),
+	}
+	for k, v := range pim {
+		s.pim[k] = v
+	}
+	for k, v := range l.apim {
+		s.apim[k] = v
+	}
+	for k, v := range l.cfgm {
+		s.cfgm[k] = v
+	}
+	return s
+}
+
+// apply the configuration entries to the library, stopping at the first error.
+func (l *Library) apply(m []Config) error {
 	for line, cfg := range m {
+		if api, ok := l.resolveAPI(cfg.API); ok {
+			cfg.API = api // the best version for any constraint
+		}
+		if len(cfg.Rules) > 0 && !cfg.Disabled {
+			if err := l.addRules(line+1, cfg); err != nil {
+				return err
+			}
+		}
 		if cfg.Plugin == "" { // unnamed plugin => pre-programmed
 			if cfg.Disabled { // disable existing entries
 				l.Disable(cfg.API, cfg.Actions)
@@ -1,10 +1,14 @@
 package glick_test
 
 import (
+	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/documize/glick"
 	test "github.com/documize/glick/_test"
+
+	"golang.org/x/net/context"
 )
 
 func TestBadConfig(t *testing.T) {
@@ -112,3 +116,213 @@ func TestConfig2(t *testing.T) {
 		t.Error("unsuited URL not spotted")
 	}
 }
+
+func TestReconfigure(t *testing.T) {
+	l, ne := glick.New(nil)
+	if ne != nil {
+		t.Error(ne)
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	goPlug := func(ctx context.Context, in interface{}) (interface{}, error) {
+		s := "go"
+		return &s, nil
+	}
+	if err := l.RegPlugin("string/*string", "base", goPlug, nil); err != nil {
+		t.Error(err)
+	}
+	run := func(act string) string {
+		ret, err := l.Run(nil, "string/*string", act, "")
+		if err != nil {
+			return err.Error()
+		}
+		return *ret.(*string)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p1","API":"string/*string","Actions":["base","extra"],"Type":"CMD","Cmd":["echo","cmd"]}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if run("base") != "cmd\n" || run("extra") != "cmd\n" {
+		t.Error("configuration did not overload base plugin")
+	}
+	if err := l.Reconfigure([]byte(`[
+{"Plugin":"p2","API":"string/*string","Actions":["other"],"Type":"CMD","Cmd":["echo","other"]}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if run("base") != "go" {
+		t.Error("reconfiguration did not restore base plugin")
+	}
+	if acts, _ := l.Actions("string/*string"); len(acts) != 2 || acts[0] != "base" || acts[1] != "other" {
+		t.Errorf("reconfiguration did not replace actions, got %v", acts)
+	}
+	if err := l.Reconfigure([]byte(`[
+{"API":"string/*string","Actions":["base"],"Disabled":true},
+{"Plugin":"p3","API":"string/*string","Actions":["bad"],"Type":"CMD","Cmd":["garbage"]}
+		]`)); err == nil {
+		t.Error("bad reconfiguration did not error")
+	}
+	if run("base") != "go" || run("other") != "other\n" {
+		t.Error("bad reconfiguration changed the plugins")
+	}
+	if err := l.Reconfigure([]byte(`[
+{"API":"string/*string","Actions":["base"],"Disabled":true}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if acts, _ := l.Actions("string/*string"); len(acts) != 0 {
+		t.Errorf("reconfiguration did not disable base plugin, got %v", acts)
+	}
+	if err := l.Reconfigure([]byte(`[]`)); err != nil {
+		t.Error(err)
+	}
+	if run("base") != "go" {
+		t.Error("empty reconfiguration did not restore disabled base plugin")
+	}
+}
+
+func TestReconfigureRPCservers(t *testing.T) {
+	l, ne := glick.New(nil)
+	if ne != nil {
+		t.Error(ne)
+	}
+	var is test.IntStr
+	outProtoInt := func() interface{} { var i int; return interface{}(&i) }
+	if err := l.RegAPI("test", is, outProtoInt, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"sleeper","API":"test","Actions":["nap"],"Type":"RPC","Path":"localhost:4243","Method":"foo.bar","Cmd":["sleep","60"]}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if err := l.StartLocalRPCservers(ioutil.Discard, ioutil.Discard); err != nil {
+		t.Error(err)
+	}
+	if err := l.Reconfigure([]byte(`[]`)); err != nil {
+		t.Error(err)
+	}
+	if err := l.KillSubProcs(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRestartRPCservers(t *testing.T) {
+	l, ne := glick.New(nil)
+	if ne != nil {
+		t.Error(ne)
+	}
+	var is test.IntStr
+	outProtoInt := func() interface{} { var i int; return interface{}(&i) }
+	if err := l.RegAPI("test", is, outProtoInt, time.Second); err != nil {
+		t.Error(err)
+	}
+	exits := make(chan struct{}, 2)
+	if err := l.AddEventSink(func(ev glick.Event) {
+		if ev.Kind == glick.EventSubProcExit {
+			exits <- struct{}{}
+		}
+	}); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"quitter","API":"test","Actions":["quit"],"Type":"RPC","Path":"localhost:4244","Method":"foo.bar","Cmd":["true"]}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ { // the server which exited is started again
+		if err := l.StartLocalRPCservers(ioutil.Discard, ioutil.Discard); err != nil {
+			t.Error(err)
+		}
+		select {
+		case <-exits:
+		case <-time.After(5 * time.Second):
+			t.Fatal("local RPC server not started")
+		}
+		if n := len(l.State().SubProcs); n != 0 {
+			t.Errorf("%d exited servers still recorded", n)
+		}
+	}
+}
+
+func TestConfigureUnlocked(t *testing.T) {
+	l, ne := glick.New(nil)
+	if ne != nil {
+		t.Error(ne)
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "busy", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	if err := l.AddConfigurator("SLOW", func(s *glick.Library, line int, cfg *glick.Config) error {
+		// registered with the library being configured, rather than the staged copy passed in
+		if err := l.RegPlugin("abc", "direct", Tov, nil); err != nil {
+			return err
+		}
+		close(started)
+		<-release
+		return s.RegPlugin(cfg.API, cfg.Actions[0], Def, cfg)
+	}); err != nil {
+		t.Error(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- l.Configure([]byte(`[{"Plugin":"slow","API":"abc","Actions":["staged"],"Type":"SLOW"}]`))
+	}()
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("configurator blocked registering a plugin")
+	}
+	if _, err := l.Run(nil, "abc", "busy", 1); err != nil {
+		t.Error("plugin not run while configuring", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if acts, _ := l.Actions("abc"); len(acts) != 3 {
+		t.Errorf("configuration lost changes made while staging, got %v", acts)
+	}
+}
+
+func TestConfigureDiscard(t *testing.T) {
+	l, ne := glick.New(nil)
+	if ne != nil {
+		t.Error(ne)
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	started := 0
+	if err := l.AddConfigurator("START", func(s *glick.Library, line int, cfg *glick.Config) error {
+		started++
+		s.OnDiscard(func() { started-- })
+		return s.RegPlugin(cfg.API, cfg.Actions[0], Tov, cfg)
+	}); err != nil {
+		t.Error(err)
+	}
+	l.OnDiscard(func() { t.Error("discard called outside a configuration") })
+	if err := l.Configure([]byte(`[
+{"Plugin":"p1","API":"abc","Actions":["a"],"Type":"START"},
+{"Plugin":"p2","API":"abc","Actions":["b"],"Type":"garbage"}
+		]`)); err == nil {
+		t.Error("bad configuration not spotted")
+	}
+	if started != 0 {
+		t.Errorf("%d started by a failed configuration not undone", started)
+	}
+	if err := l.Configure([]byte(`[{"Plugin":"p1","API":"abc","Actions":["a"],"Type":"START"}]`)); err != nil {
+		t.Error(err)
+	}
+	if started != 1 {
+		t.Errorf("%d started by a good configuration, wanted 1", started)
+	}
+}
@@ -0,0 +1,71 @@
+package glick
+
+import (
+	"errors"
+	"time"
+)
+
+// EventKind gives the type of a lifecycle Event.
+type EventKind string
+
+// The kinds of lifecycle Event.
+const (
+	EventRegAPI       EventKind = "regapi"        // an API was registered
+	EventRegPlugin    EventKind = "regplugin"     // a plugin was registered, or overloaded an existing one
+	EventDisable      EventKind = "disable"       // a plugin was disabled
+	EventConfigure    EventKind = "configure"     // a configuration was applied, or failed
+	EventSubProcStart EventKind = "subproc-start" // a local RPC server was started
+	EventSubProcExit  EventKind = "subproc-exit"  // a local RPC server exited
+	EventRunStart     EventKind = "run-start"     // a call to a plugin started
+	EventRunFinish    EventKind = "run-finish"    // a call to a plugin finished
+)
+
+// Event describes something that happened in the lifecycle of a Library,
+// only the fields relevant to its Kind are set.
+type Event struct {
+	Kind        EventKind
+	Time        time.Time
+	API, Action string
+	Config      *Config       // the configuration of a registered plugin if any, with the Token redacted
+	Overload    bool          // a registered plugin replaced an existing one
+	Replace     bool          // a configuration replaced the existing one, using Reconfigure()
+	Entries     int           // the number of entries in a configuration
+	Plugin      string        // the name of a local RPC server
+	Pid         int           // the process id of a local RPC server
+	Served      string        // the action which served a call, which may be a fallback
+	Overloaded  bool          // the overloader chose a different handler for a call
+	Duration    time.Duration // how long a call took
+	Err         error         // the error from a configuration, call or local RPC server
+}
+
+// EventSink is called with each lifecycle Event of a Library.
+// Sinks are called synchronously, outside of the library lock, so should return quickly.
+type EventSink func(ev Event)
+
+// AddEventSink adds a sink to receive the lifecycle events of the library.
+func (l *Library) AddEventSink(sink EventSink) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	if sink == nil {
+		return errors.New("nil event sink")
+	}
+	l.emtx.Lock()
+	l.sinks = append(l.sinks, sink)
+	l.emtx.Unlock()
+	return nil
+}
+
+// emit sends an Event to every sink, it must not be called with the library locked.
+func (l *Library) emit(ev Event) {
+	l.emtx.RLock()
+	sinks := l.sinks
+	l.emtx.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+	ev.Time = time.Now()
+	for _, sink := range sinks {
+		sink(ev)
+	}
+}
@@ -0,0 +1,142 @@
+package glick_test
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+	test "github.com/documize/glick/_test"
+)
+
+// eventLog collects the events from a Library.
+type eventLog struct {
+	mtx sync.Mutex
+	evs []glick.Event
+}
+
+func (el *eventLog) sink(ev glick.Event) {
+	el.mtx.Lock()
+	el.evs = append(el.evs, ev)
+	el.mtx.Unlock()
+}
+
+// take returns the events collected so far, and forgets them.
+func (el *eventLog) take() []glick.Event {
+	el.mtx.Lock()
+	defer el.mtx.Unlock()
+	ret := el.evs
+	el.evs = nil
+	return ret
+}
+
+func TestEvents(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := l.AddEventSink(nil); err == nil {
+		t.Error("nil event sink not spotted")
+	}
+	var el eventLog
+	if err := l.AddEventSink(el.sink); err != nil {
+		t.Error(err)
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("string/*string", "pwd", glick.PluginCmd([]string{"pwd"}, &protoString), nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("string/*string", "pwd", glick.PluginCmd([]string{"pwd"}, &protoString), nil); err != nil {
+		t.Error(err)
+	}
+	evs := el.take()
+	if len(evs) != 3 || evs[0].Kind != glick.EventRegAPI || evs[0].API != "string/*string" ||
+		evs[1].Kind != glick.EventRegPlugin || evs[1].Overload ||
+		evs[2].Kind != glick.EventRegPlugin || !evs[2].Overload || evs[2].Time.IsZero() {
+		t.Errorf("wrong registration events %#v", evs)
+	}
+	if _, err := l.Run(nil, "string/*string", "pwd", ""); err != nil {
+		t.Error(err)
+	}
+	evs = el.take()
+	if len(evs) != 2 || evs[0].Kind != glick.EventRunStart || evs[0].Action != "pwd" ||
+		evs[1].Kind != glick.EventRunFinish || evs[1].Served != "pwd" || evs[1].Duration == 0 {
+		t.Errorf("wrong run events %#v", evs)
+	}
+	l.Disable("string/*string", []string{"pwd"})
+	evs = el.take()
+	if len(evs) != 1 || evs[0].Kind != glick.EventDisable || evs[0].Action != "pwd" {
+		t.Errorf("wrong disable events %#v", evs)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p1","API":"string/*string","Actions":["a","b"],"Type":"CMD","Cmd":["pwd"],"Comment":"ticket 42","Token":"secret"}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	evs = el.take()
+	if len(evs) != 3 || evs[0].Kind != glick.EventRegPlugin || evs[0].Action != "a" ||
+		evs[0].Config == nil || evs[0].Config.Comment != "ticket 42" ||
+		evs[0].Config.Token != glick.RedactedToken || evs[1].Action != "b" ||
+		evs[2].Kind != glick.EventConfigure || evs[2].Entries != 1 || evs[2].Err != nil {
+		t.Errorf("wrong configure events %#v", evs)
+	}
+	if err := l.Reconfigure([]byte(`[]`)); err != nil {
+		t.Error(err)
+	}
+	evs = el.take()
+	if len(evs) != 3 || evs[0].Kind != glick.EventDisable || evs[1].Kind != glick.EventDisable ||
+		evs[2].Kind != glick.EventConfigure || !evs[2].Replace {
+		t.Errorf("wrong reconfigure events %#v", evs)
+	}
+	if err := l.Configure([]byte(`rubbish`)); err == nil {
+		t.Error("rubbish configuration did not error")
+	}
+	evs = el.take()
+	if len(evs) != 1 || evs[0].Kind != glick.EventConfigure || evs[0].Err == nil {
+		t.Errorf("wrong failed configure events %#v", evs)
+	}
+}
+
+func TestEventsSubProcs(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var el eventLog
+	if err := l.AddEventSink(el.sink); err != nil {
+		t.Error(err)
+	}
+	var is test.IntStr
+	outProtoInt := func() interface{} { var i int; return interface{}(&i) }
+	if err := l.RegAPI("test", is, outProtoInt, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"sleeper","API":"test","Actions":["nap"],"Type":"RPC","Path":"localhost:4243","Method":"foo.bar","Cmd":["sleep","60"]}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	el.take()
+	if err := l.StartLocalRPCservers(ioutil.Discard, ioutil.Discard); err != nil {
+		t.Error(err)
+	}
+	if err := l.KillSubProcs(); err != nil {
+		t.Error(err)
+	}
+	var evs []glick.Event
+	for i := 0; i < 100 && len(evs) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		evs = append(evs, el.take()...)
+	}
+	if len(evs) != 2 || evs[0].Kind != glick.EventSubProcStart || evs[0].Plugin != "sleeper" ||
+		evs[1].Kind != glick.EventSubProcExit || evs[1].Pid != evs[0].Pid || evs[1].Err == nil {
+		t.Errorf("wrong sub-process events %#v", evs)
+	}
+}
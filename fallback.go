@@ -0,0 +1,131 @@
+package glick
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/net/context"
+)
+
+// The classes of error which can cause a fallback to another action.
+const (
+	ErrClassAny     = "any"     // any error at all
+	ErrClassTimeout = "timeout" // the plugin timed-out
+	ErrClassDial    = "dial"    // the plugin could not connect to its server
+
+	ErrClassPanic = "panic" // the plugin panicked
+
+	// the plugin was not called, as it was unhealthy, quarantined or its circuit breaker was open
+	ErrClassUnavailable = "unavailable"
+)
+
+// errClass means that the name of an error class is not known.
+func errClass(name string) error {
+	return errors.New("unknown error class: " + name)
+}
+
+// fallback holds the actions to try, in order, if a plugin fails with one of the error classes.
+type fallback struct {
+	actions []string
+	on      []string
+}
+
+func newFallback(actions, on []string) (fallback, error) {
+	for _, c := range on {
+		switch c {
+		case ErrClassAny, ErrClassTimeout, ErrClassDial, ErrClassPanic, ErrClassUnavailable:
+		default:
+			return fallback{}, errClass(c)
+		}
+	}
+	return fallback{actions: actions, on: on}, nil
+}
+
+// triggers returns true if the error should cause a fallback, any error does so by default.
+func (fb fallback) triggers(err error) bool {
+	if err == nil {
+		return false
+	}
+	if len(fb.on) == 0 {
+		return true
+	}
+	for _, c := range fb.on {
+		if IsErrClass(err, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsErrClass returns true if the error is of the named class.
+func IsErrClass(err error, class string) bool {
+	if err == nil {
+		return false
+	}
+	switch class {
+	case ErrClassAny:
+		return true
+	case ErrClassTimeout:
+		if err == context.DeadlineExceeded {
+			return true
+		}
+		var ne net.Error
+		return errors.As(err, &ne) && ne.Timeout()
+	case ErrClassDial:
+		var oe *net.OpError
+		return errors.As(err, &oe) && oe.Op == "dial"
+	case ErrClassPanic:
+		var pe *PanicError
+		return errors.As(err, &pe)
+	case ErrClassUnavailable:
+		var ue *UnhealthyError
+		var be *BreakerOpenError
+		var qe *QuarantinedError
+		return errors.As(err, &ue) || errors.As(err, &be) || errors.As(err, &qe)
+	}
+	return false
+}
+
+// RegFallback sets the actions on the same api to try, in order, if the plugin
+// for an action fails with an error of one of the given classes (any error if none are given).
+// This is the same as setting the Fallback and FallbackOn fields of the plugin Config.
+func (l *Library) RegFallback(api, action string, on []string, actions ...string) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	key := plugkey{api, action}
+	pv, found := l.pim[key]
+	if !found {
+		return errNoPlug(api + "/" + action)
+	}
+	fb, err := newFallback(actions, on)
+	if err != nil {
+		return err
+	}
+	pv.fb = fb
+	l.pim[key] = pv
+	return nil
+}
+
+// fallback walks the fallback actions while the error in the Result triggers them.
+func (l *Library) fallback(ctx context.Context, c call, r Result) Result {
+	fb := c.pv.fb
+	for _, action := range fb.actions {
+		if !fb.triggers(r.Err) || ctx.Err() != nil {
+			break
+		}
+		l.mtx.RLock()
+		pv, found := l.pim[plugkey{c.api, action}]
+		l.mtx.RUnlock()
+		if !found {
+			continue
+		}
+		fc := c
+		fc.action, fc.pv, fc.overloaded, fc.rerouted = action, l.choose(ctx, c.api, action, pv), false, false
+		r.Action, r.Overloaded = action, false
+		r.Out, r.Err = l.attempt(ctx, fc, fc.pv.plug)
+	}
+	return r
+}
@@ -0,0 +1,89 @@
+package glick_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+)
+
+func TestFallback(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, 50*time.Millisecond); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "go", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "down",
+		glick.PluginRPC(true, "CI.CopyIntX", "localhost:1", outTov),
+		&glick.Config{Fallback: []string{"missing", "go"}, FallbackOn: []string{"dial"}}); err != nil {
+		t.Error(err)
+	}
+	if r := l.Call(nil, "abc", "down", 1); r.Err != nil || r.Action != "go" || !*r.Out.(*bool) {
+		t.Errorf("dial error did not fall back, got %#v", r)
+	}
+	if err := l.RegPlugin("abc", "bad", JustBad,
+		&glick.Config{Fallback: []string{"go"}, FallbackOn: []string{"timeout", "dial"}}); err != nil {
+		t.Error(err)
+	}
+	if r := l.Call(nil, "abc", "bad", 1); r.Err == nil || r.Action != "bad" {
+		t.Errorf("other error should not fall back, got %#v", r)
+	}
+	if err := l.RegPlugin("abc", "forever", Forever,
+		&glick.Config{Fallback: []string{"go"}, FallbackOn: []string{"timeout"}}); err != nil {
+		t.Error(err)
+	}
+	if r := l.Call(nil, "abc", "forever", 1); r.Err != nil || r.Action != "go" {
+		t.Errorf("timeout did not fall back, got %#v", r)
+	}
+	if err := l.RegPlugin("abc", "odd", JustBad,
+		&glick.Config{Fallback: []string{"go"}, FallbackOn: []string{"odd"}}); err == nil {
+		t.Error("unknown error class not spotted")
+	}
+	if err := l.RegFallback("abc", "missing", nil, "go"); err == nil {
+		t.Error("missing plugin not spotted")
+	}
+	if err := l.RegFallback("abc", "bad", []string{"odd"}, "go"); err == nil {
+		t.Error("unknown error class not spotted")
+	}
+	if err := l.RegFallback("abc", "bad", nil, "forever", "go"); err != nil {
+		t.Error(err)
+	}
+	if out, err := l.Run(nil, "abc", "bad", 1); err != nil || !*out.(*bool) {
+		t.Error("any error did not fall back through the chain", err)
+	}
+}
+
+func TestFallbackConfig(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p1","API":"string/*string","Actions":["pwd"],"Type":"CMD","Cmd":["pwd"]},
+{"Plugin":"p2","API":"string/*string","Actions":["exit1"],"Type":"CMD","Cmd":["bash","./_test/exit1.sh"],"Fallback":["pwd"]}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if r := l.Call(nil, "string/*string", "exit1", ""); r.Err != nil || r.Action != "pwd" {
+		t.Errorf("configured fallback not used, got %#v", r)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p3","API":"string/*string","Actions":["odd"],"Type":"CMD","Cmd":["pwd"],"FallbackOn":["odd"]}
+		]`)); err == nil {
+		t.Error("unknown error class in config not spotted")
+	}
+}
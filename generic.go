@@ -0,0 +1,76 @@
+//go:build go1.18
+// +build go1.18
+
+package glick
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// API is a type-safe view of an API registered in a Library,
+// where In is the type passed to each plugin and Out the type it returns.
+// If Out is a pointer type, the output prototype is a pointer to a new value,
+// as needed by the "RPC" and "KIT" plugins.
+type API[In, Out any] struct {
+	lib  *Library
+	name string
+}
+
+// NewAPI registers an API in the library using the types In and Out as the prototypes,
+// the other parameters are as for RegAPI(). In must not be an interface type.
+func NewAPI[In, Out any](l *Library, api string, timeout time.Duration, opts ...APIOption) (*API[In, Out], error) {
+	if l == nil {
+		return nil, ErrNilLib
+	}
+	var in In
+	outT := reflect.TypeOf((*Out)(nil)).Elem()
+	proto := func() interface{} {
+		if outT.Kind() == reflect.Ptr {
+			return reflect.New(outT.Elem()).Interface()
+		}
+		var out Out
+		return out
+	}
+	if err := l.RegAPI(api, in, proto, timeout, opts...); err != nil {
+		return nil, err
+	}
+	return &API[In, Out]{lib: l, name: api}, nil
+}
+
+// Name returns the name of the API in the library.
+func (a *API[In, Out]) Name() string {
+	return a.name
+}
+
+// Reg registers a typed function as the plugin for an action on the API,
+// cfg is as for RegPlugin() and may be nil.
+func (a *API[In, Out]) Reg(action string, fn func(ctx context.Context, in In) (Out, error), cfg *Config) error {
+	if fn == nil {
+		return errNoPlug("nil handler for api " + a.name)
+	}
+	return a.lib.RegPlugin(a.name, action, func(ctx context.Context, in interface{}) (interface{}, error) {
+		i, ok := in.(In)
+		if !ok {
+			return nil, fmt.Errorf("bad api types - in: got %T want %T", in, i)
+		}
+		return fn(ctx, i)
+	}, cfg)
+}
+
+// Run runs the plugin for an action on the API, as Run() on the Library, returning a typed output.
+func (a *API[In, Out]) Run(ctx context.Context, action string, in In) (Out, error) {
+	var out Out
+	ret, err := a.lib.Run(ctx, a.name, action, in)
+	if err != nil {
+		return out, err
+	}
+	out, ok := ret.(Out)
+	if !ok {
+		return out, fmt.Errorf("bad api types - out: got %T want %T", ret, out)
+	}
+	return out, nil
+}
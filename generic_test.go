@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+package glick_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+	test "github.com/documize/glick/_test"
+
+	"golang.org/x/net/context"
+)
+
+func TestGenericAPI(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if _, err := glick.NewAPI[test.IntStr, *test.IntStr](nil, "typed", time.Second); err == nil {
+		t.Error("nil library not spotted")
+	}
+	api, err := glick.NewAPI[test.IntStr, *test.IntStr](l, "typed", time.Second)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := glick.NewAPI[test.IntStr, *test.IntStr](l, "typed", time.Second); err == nil {
+		t.Error("duplicate api not spotted")
+	}
+	if err := api.Reg("double", func(ctx context.Context, in test.IntStr) (*test.IntStr, error) {
+		return &test.IntStr{I: in.I * 2}, nil
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := api.Reg("bad", func(ctx context.Context, in test.IntStr) (*test.IntStr, error) {
+		return nil, errors.New("bad")
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := api.Reg("nil", nil, nil); err == nil {
+		t.Error("nil function not spotted")
+	}
+	out, err := api.Run(nil, "double", test.IntStr{I: 21})
+	if err != nil {
+		t.Error(err)
+	} else if out.I != 42 {
+		t.Errorf("unexpected output %#v", out)
+	}
+	if _, err := api.Run(nil, "bad", test.IntStr{}); err == nil {
+		t.Error("error not returned")
+	}
+
+	// untyped plugins registered for the API work too, as long as they return the right type
+	if err := l.RegPlugin(api.Name(), "untyped", func(ctx context.Context, in interface{}) (interface{}, error) {
+		return &test.IntStr{I: 1}, nil
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	if out, err := api.Run(nil, "untyped", test.IntStr{}); err != nil || out.I != 1 {
+		t.Error("untyped plugin failed", err)
+	}
+
+	strs, err := glick.NewAPI[string, string](l, "strings", time.Second)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := strs.Reg("bang", func(ctx context.Context, in string) (string, error) {
+		return in + "!", nil
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	if out, err := strs.Run(nil, "bang", "hi"); err != nil || out != "hi!" {
+		t.Error("string api failed", out, err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 // PluginGetURL fetches the content of a URL, which could be static or dynamic (passed in).
 // It only works with an api with a simple Text/Text signature.
+// Any traceparent in the context is passed on in the request header.
 func PluginGetURL(static bool, uri string, model interface{}) Plugin {
 	if static {
 		if uri == "" {
@@ -26,7 +27,14 @@ func PluginGetURL(static bool, uri string, model interface{}) Plugin {
 		if static {
 			ins = uri
 		}
-		resp, err := ctxhttp.Get(ctx, http.DefaultClient, ins) // handles context.Done() correctly
+		req, err := http.NewRequest("GET", ins, nil)
+		if err != nil {
+			return nil, err
+		}
+		if tp := TraceParent(ctx); tp != "" {
+			req.Header.Set(TraceParentHeader, tp)
+		}
+		resp, err := ctxhttp.Do(ctx, http.DefaultClient, req) // handles context.Done() correctly
 		if err != nil {
 			return nil, err
 		}
@@ -54,11 +62,26 @@ func ConfigGetURL(lib *Library) error {
 				line, cfg.API)
 		}
 		pi := PluginGetURL(cfg.Static, cfg.Path, l.apim[cfg.API].ppo())
+		var probe Probe
+		if cfg.Static || cfg.HealthPath != "" {
+			hu, err := HealthURL(cfg.Path, cfg.HealthPath)
+			if err != nil {
+				return fmt.Errorf("entry %d URL health path error: %v",
+					line, err)
+			}
+			probe = ProbeURL(hu)
+		}
 		for _, action := range cfg.Actions {
 			if err := l.RegPlugin(cfg.API, action, pi, cfg); err != nil {
 				return fmt.Errorf("entry %d URL register plugin error: %v",
 					line, err)
 			}
+			if probe != nil {
+				if err := l.RegProbe(cfg.API, action, probe); err != nil {
+					return fmt.Errorf("entry %d URL register probe error: %v",
+						line, err)
+				}
+			}
 		}
 		return nil
 	})
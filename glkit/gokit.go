@@ -35,14 +35,23 @@ func MakeEndpoint(l *glick.Library, api, action string) endpoint.Endpoint {
 
 // PluginKitJSONoverHTTP enables calls to plugin commands
 // implemented as microservices using "gokit.io".
+// Any traceparent in the context is passed on in the request header.
 func PluginKitJSONoverHTTP(cmdPath string, ppo glick.ProtoPlugOut) glick.Plugin {
 	return func(ctx context.Context, in interface{}) (out interface{}, err error) {
 		var j, b []byte
+		var q *http.Request
 		var r *http.Response
 		if j, err = json.Marshal(in); err != nil {
 			return nil, err
 		}
-		if r, err = http.Post(cmdPath, "application/json", bytes.NewReader(j)); err != nil {
+		if q, err = http.NewRequest("POST", cmdPath, bytes.NewReader(j)); err != nil {
+			return nil, err
+		}
+		q.Header.Set("Content-Type", "application/json")
+		if tp := glick.TraceParent(ctx); tp != "" {
+			q.Header.Set(glick.TraceParentHeader, tp)
+		}
+		if r, err = http.DefaultClient.Do(q); err != nil {
 			return nil, err
 		}
 		if b, err = ioutil.ReadAll(r.Body); err != nil {
@@ -73,12 +82,24 @@ func ConfigKit(lib *glick.Library) error {
 				"entry %d Go-Kit: non-JSON plugins are not supported",
 				line)
 		}
+		probe := glick.ProbeDial(cfg.Path)
+		if cfg.HealthPath != "" {
+			hu, err := glick.HealthURL(cfg.Path, cfg.HealthPath)
+			if err != nil {
+				return fmt.Errorf("entry %d Go-Kit health path error: %v", line, err)
+			}
+			probe = glick.ProbeURL(hu)
+		}
 		for _, action := range cfg.Actions {
 			if err := l.RegPlugin(cfg.API, action, PluginKitJSONoverHTTP(cfg.Path, ppo), cfg); err != nil {
 				// internal error, simple test case impossible
 				return fmt.Errorf("entry %d Go-Kit register plugin error: %v",
 					line, err)
 			}
+			if err := l.RegProbe(cfg.API, action, probe); err != nil {
+				return fmt.Errorf("entry %d Go-Kit register probe error: %v",
+					line, err)
+			}
 		}
 		return nil
 	})
@@ -5,6 +5,7 @@
 package glpie
 
 import (
+	"errors"
 	"fmt"
 	"net/rpc"
 	"net/rpc/jsonrpc"
@@ -47,6 +48,9 @@ func (p *pi) newClient() {
 func (p *pi) plugin(ctx context.Context, in, out interface{}) error {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
+	if p.err == errStopped {
+		return p.err
+	}
 	if p.err != nil {
 		defer p.newClient() //set up again if we've had an error last time
 		return p.err
@@ -54,18 +58,44 @@ func (p *pi) plugin(ctx context.Context, in, out interface{}) error {
 	return p.client.Call(p.serviceMethod, in, out)
 }
 
+// probe checks that the plugin process started without error.
+func (p *pi) probe(ctx context.Context) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.err
+}
+
+// errStopped means that the plugin process was stopped, as its configuration was discarded.
+var errStopped = errors.New("pie plugin stopped")
+
+// stop ends the plugin process, if it started, and stops it being started again.
+func (p *pi) stop() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.err == nil && p.client != nil {
+		_ = p.client.Close() // the error is of no use, as the plugin is discarded
+	}
+	p.client, p.err = nil, errStopped
+}
+
 // PluginPie enables plugin commands created using github.com/natefinch/pie.
 func PluginPie(useJSON bool, serviceMethod string, cmd []string, ppo glick.ProtoPlugOut) glick.Plugin {
+	pl, _, _ := pluginPie(useJSON, serviceMethod, cmd, ppo)
+	return pl
+}
+
+// pluginPie returns the plugin, the probe for its health and the function to stop its process.
+func pluginPie(useJSON bool, serviceMethod string, cmd []string, ppo glick.ProtoPlugOut) (glick.Plugin, glick.Probe, func()) {
 	if len(cmd) == 0 {
-		return nil
+		return nil, nil, nil
 	}
 	f, e := os.Open(cmd[0])
 	if e != nil {
-		return nil
+		return nil, nil, nil
 	}
 	e = f.Close()
 	if e != nil {
-		return nil
+		return nil, nil, nil
 	}
 	ret := &pi{useJSON, serviceMethod, cmd[0], cmd[1:], sync.Mutex{}, nil, nil}
 	ret.newClient()
@@ -73,7 +103,7 @@ func PluginPie(useJSON bool, serviceMethod string, cmd []string, ppo glick.Proto
 		out = ppo()
 		err = ret.plugin(ctx, in, out)
 		return
-	}
+	}, ret.probe, ret.stop
 }
 
 // ConfigPIE provides the Configurator for the PIE class of plugin.
@@ -87,12 +117,19 @@ func ConfigPIE(lib *glick.Library) error {
 			return fmt.Errorf("entry %d PIE register plugin error: %v",
 				line, err) // no simple test possible for this path
 		}
-		pi := PluginPie(!cfg.Gob, cfg.Method, cfg.Cmd, ppo)
+		pi, probe, stop := pluginPie(!cfg.Gob, cfg.Method, cfg.Cmd, ppo)
+		if stop != nil {
+			l.OnDiscard(stop) // so that the process does not leak if the configuration fails
+		}
 		for _, action := range cfg.Actions {
 			if err := l.RegPlugin(cfg.API, action, pi, cfg); err != nil {
 				return fmt.Errorf("entry %d PIE register plugin error: %v",
 					line, err)
 			}
+			if err := l.RegProbe(cfg.API, action, probe); err != nil {
+				return fmt.Errorf("entry %d PIE register probe error: %v",
+					line, err)
+			}
 		}
 		return nil
 	})
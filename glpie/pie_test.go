@@ -2,6 +2,9 @@ package glpie_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -123,3 +126,55 @@ func TestPie(t *testing.T) {
 	pieSwitchTest(t, true)
 	pieSwitchTest(t, false)
 }
+
+// running counts the processes started from the command, using /proc.
+func running(t *testing.T, cmd string) int {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil || len(cmdlines) == 0 {
+		t.Skip("no /proc to count processes")
+	}
+	n := 0
+	for _, cl := range cmdlines {
+		if b, err := ioutil.ReadFile(cl); err == nil && strings.HasPrefix(string(b), cmd+"\x00") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPieDiscard(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := glpie.ConfigPIE(l); err != nil {
+		t.Error(err)
+		return
+	}
+	tisOut := func() interface{} {
+		return interface{}(&test.IntStr{})
+	}
+	if err := l.RegAPI("discard", test.IntStr{}, tisOut, 2*time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	cmdPath := "./_test/json/json"
+	before := running(t, cmdPath)
+	if err := l.Configure([]byte(`[
+{"Plugin":"pie1","API":"discard","Actions":["intStr1"],"Type":"PIE","Cmd":["` + cmdPath + `"],"Method":"CI.CopyIntX"},
+{"Plugin":"bad","API":"discard","Actions":["intStr2"],"Type":"garbage"}
+		]`)); err == nil {
+		t.Error("bad configuration not spotted")
+	}
+	n := 0
+	for i := 0; i < 50; i++ {
+		if n = running(t, cmdPath); n == before {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n != before {
+		t.Errorf("%d pie processes left by a bad configuration", n-before)
+	}
+}
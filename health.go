@@ -0,0 +1,237 @@
+package glick
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Probe checks the health of a plugin, returning an error if it is unhealthy.
+type Probe func(ctx context.Context) error
+
+// UnhealthyError is returned, without running the plugin,
+// when the last health check of an api/action failed.
+type UnhealthyError struct {
+	API, Action string
+	Err         error // the error from the Probe
+}
+
+func (e *UnhealthyError) Error() string {
+	return fmt.Sprintf("unhealthy plugin for api %s action %s: %v", e.API, e.Action, e.Err)
+}
+
+// HealthReport gives the health of the plugin for an api/action.
+type HealthReport struct {
+	API, Action string
+	Variant     int    // the index of the plugin among the weighted plugins for the api/action, in the order registered
+	Probed      bool   // the plugin has a Probe, otherwise it is assumed healthy
+	Healthy     bool   // the last Probe succeeded
+	Error       string // the error from the last Probe, if it failed
+	Checked     time.Time
+}
+
+// ProbeDial returns a Probe which checks that a TCP connection can be made
+// to the end-point of an "RPC" plugin.
+func ProbeDial(endPoint string) Probe {
+	if u, err := url.Parse(endPoint); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		endPoint = u.Host
+	}
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", endPoint)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// ProbeURL returns a Probe which checks that an HTTP GET of the URL succeeds
+// without a server error.
+func ProbeURL(uri string) Probe {
+	return func(ctx context.Context) error {
+		resp, err := ctxhttp.Get(ctx, http.DefaultClient, uri)
+		if err != nil {
+			return err
+		}
+		if err := resp.Body.Close(); err != nil {
+			return err
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return errors.New("health check status: " + resp.Status)
+		}
+		return nil
+	}
+}
+
+// ProbeCmd returns a Probe which checks that an operating system command can still be run.
+func ProbeCmd(cmd string) Probe {
+	return func(ctx context.Context) error {
+		path, err := exec.LookPath(cmd)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stat(path)
+		return err
+	}
+}
+
+// HealthURL returns the URL for a health check of a plugin at uri,
+// the Config HealthPath is resolved relative to the URL if it is set.
+func HealthURL(uri, healthPath string) (string, error) {
+	if healthPath == "" {
+		return uri, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	h, err := url.Parse(healthPath)
+	if err != nil {
+		return "", err
+	}
+	return u.ResolveReference(h).String(), nil
+}
+
+// RegProbe sets the Probe which checks the health of the plugin for an api/action,
+// if there are weighted plugins for the api/action it is set for the one registered last.
+func (l *Library) RegProbe(api, action string, probe Probe) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	if probe == nil {
+		return errors.New("nil probe")
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	key := plugkey{api, action}
+	pv, found := l.pim[key]
+	if !found {
+		return errNoPlug(api + "/" + action)
+	}
+	if n := len(pv.weighted); n > 0 {
+		pv.weighted = append([]plugval{}, pv.weighted...)
+		pv.weighted[n-1].probe = probe
+	}
+	pv.probe = probe
+	l.pim[key] = pv
+	return nil
+}
+
+// healthKey identifies one of the weighted plugins for an api/action, see plugval.variant.
+type healthKey struct {
+	plugkey
+	variant int
+}
+
+// healthy returns an UnhealthyError if the last health check of the plugin for the api/action failed.
+func (l *Library) healthy(api, action string, variant int) error {
+	l.hmtx.Lock()
+	defer l.hmtx.Unlock()
+	if h, found := l.health[healthKey{plugkey{api, action}, variant}]; found && !h.Healthy {
+		return &UnhealthyError{API: api, Action: action, Err: errors.New(h.Error)}
+	}
+	return nil
+}
+
+// forgetHealth removes the health of the plugins for an api/action which has been replaced.
+func (l *Library) forgetHealth(key plugkey) {
+	l.hmtx.Lock()
+	for hk := range l.health {
+		if hk.plugkey == key {
+			delete(l.health, hk)
+		}
+	}
+	l.hmtx.Unlock()
+}
+
+// Health runs the Probe of every plugin now, returning a report on each plugin sorted by api, action and variant.
+// Calls to plugins found to be unhealthy fail fast with an UnhealthyError,
+// so that any fallback actions are used, until a later health check succeeds.
+func (l *Library) Health(ctx context.Context) []HealthReport {
+	if l == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l.mtx.RLock()
+	ret := make([]HealthReport, 0, len(l.pim))
+	var probes []Probe
+	for k, pv := range l.pim {
+		for _, v := range pv.variants() {
+			ret = append(ret, HealthReport{API: k.api, Action: k.action, Variant: v.variant, Healthy: true})
+			probes = append(probes, v.probe)
+		}
+	}
+	l.mtx.RUnlock()
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		if probe == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(h *HealthReport, probe Probe) {
+			defer wg.Done()
+			h.Probed = true
+			if err := probe(ctx); err != nil {
+				h.Healthy, h.Error = false, err.Error()
+			}
+			h.Checked = time.Now()
+		}(&ret[i], probe)
+	}
+	wg.Wait()
+	l.hmtx.Lock()
+	for _, h := range ret {
+		if h.Probed {
+			l.health[healthKey{plugkey{h.API, h.Action}, h.Variant}] = h
+		}
+	}
+	l.hmtx.Unlock()
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].API != ret[j].API {
+			return ret[i].API < ret[j].API
+		}
+		if ret[i].Action != ret[j].Action {
+			return ret[i].Action < ret[j].Action
+		}
+		return ret[i].Variant < ret[j].Variant
+	})
+	return ret
+}
+
+// WatchHealth runs Health() at the given interval (default 10 seconds),
+// each round of probes must complete within the interval.
+// The returned function stops the health checks.
+func (l *Library) WatchHealth(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			l.Health(ctx)
+			cancel()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(done) }) }
+}
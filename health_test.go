@@ -0,0 +1,143 @@
+package glick_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+	test "github.com/documize/glick/_test"
+
+	"golang.org/x/net/context"
+)
+
+func TestHealth(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "go", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	sick := false
+	if err := l.RegPlugin("abc", "sick", Tov,
+		&glick.Config{Fallback: []string{"go"}, FallbackOn: []string{"unavailable"}}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegProbe("abc", "sick", nil); err == nil {
+		t.Error("nil probe not spotted")
+	}
+	if err := l.RegProbe("abc", "missing", glick.ProbeCmd("pwd")); err == nil {
+		t.Error("missing plugin not spotted")
+	}
+	if err := l.RegProbe("abc", "sick", func(ctx context.Context) error {
+		if sick {
+			return net.ErrClosed
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+	if r := l.Call(nil, "abc", "sick", 1); r.Err != nil || r.Action != "sick" {
+		t.Error("unchecked plugin not run", r)
+	}
+	sick = true
+	hr := l.Health(nil)
+	if len(hr) != 2 || hr[0].Action != "go" || hr[0].Probed || !hr[0].Healthy ||
+		hr[1].Action != "sick" || !hr[1].Probed || hr[1].Healthy || hr[1].Error == "" {
+		t.Errorf("wrong health report %#v", hr)
+	}
+	if r := l.Call(nil, "abc", "sick", 1); r.Err != nil || r.Action != "go" {
+		t.Error("unhealthy plugin did not fall back", r)
+	}
+	if err := l.RegFallback("abc", "sick", nil); err != nil {
+		t.Error(err)
+	}
+	_, err := l.Run(nil, "abc", "sick", 1)
+	if _, ok := err.(*glick.UnhealthyError); !ok || !glick.IsErrClass(err, glick.ErrClassUnavailable) {
+		t.Error("unhealthy plugin did not fail fast", err)
+	}
+	sick = false
+	stop := l.WatchHealth(10 * time.Millisecond)
+	defer stop()
+	for i := 0; i < 100; i++ {
+		if _, err = l.Run(nil, "abc", "sick", 1); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Error("recovered plugin not run", err)
+	}
+	stop()
+}
+
+func TestHealthProbes(t *testing.T) {
+	ctx := context.Background()
+	if err := glick.ProbeCmd("pwd")(ctx); err != nil {
+		t.Error(err)
+	}
+	if err := glick.ProbeCmd("garbage")(ctx); err == nil {
+		t.Error("missing command probe did not fail")
+	}
+	if err := glick.ProbeDial("localhost:1")(ctx); err == nil {
+		t.Error("closed port probe did not fail")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			http.Error(w, "bad", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	if err := glick.ProbeDial(srv.URL)(ctx); err != nil {
+		t.Error(err)
+	}
+	if err := glick.ProbeURL(srv.URL + "/ok")(ctx); err != nil {
+		t.Error(err)
+	}
+	if err := glick.ProbeURL(srv.URL + "/bad")(ctx); err == nil {
+		t.Error("server error probe did not fail")
+	}
+
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, time.Second); err != nil {
+		t.Error(err)
+	}
+	var is test.IntStr
+	outProtoInt := func() interface{} { var i int; return interface{}(&i) }
+	if err := l.RegAPI("test", is, outProtoInt, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p1","API":"string/*string","Actions":["pwd"],"Type":"CMD","Cmd":["pwd"]},
+{"Plugin":"p2","API":"string/*string","Actions":["ok"],"Type":"URL","Path":"` + srv.URL + `/page","Static":true,"HealthPath":"/ok"},
+{"Plugin":"p3","API":"string/*string","Actions":["bad"],"Type":"URL","Path":"` + srv.URL + `/page","Static":true,"HealthPath":"/bad"},
+{"Plugin":"p4","API":"string/*string","Actions":["dynamic"],"Type":"URL"},
+{"Plugin":"p5","API":"test","Actions":["rpc"],"Type":"RPC","Path":"localhost:1","Method":"foo.bar"}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	var report []string
+	for _, h := range l.Health(ctx) {
+		report = append(report, h.Action+":"+map[bool]string{true: "y", false: "n"}[h.Probed]+
+			map[bool]string{true: "y", false: "n"}[h.Healthy])
+	}
+	if r := strings.Join(report, ","); r != "bad:yn,dynamic:ny,ok:yy,pwd:yy,rpc:yn" {
+		t.Error("wrong health of configured plugins", r)
+	}
+}
@@ -0,0 +1,73 @@
+package glick
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+)
+
+// errLimit means that a concurrency limit is invalid.
+var errLimit = errors.New("concurrency limit must not be negative")
+
+// GlobalLimit sets the most plugins that may run at once across the Library, 0 for no limit.
+func GlobalLimit(n int) Option {
+	return func(l *Library) error {
+		if n < 0 {
+			return errLimit
+		}
+		l.sem = nil
+		if n > 0 {
+			l.sem = make(chan struct{}, n)
+		}
+		return nil
+	}
+}
+
+// Limit sets the most plugins for an API that may run at once, 0 for no limit.
+// The Limit field of the Config sets the limit for a plugin, shared by all its actions.
+func Limit(n int) APIOption {
+	return func(def *apidef) error {
+		if n < 0 {
+			return errLimit
+		}
+		def.sem = nil
+		if n > 0 {
+			def.sem = make(chan struct{}, n)
+		}
+		return nil
+	}
+}
+
+// limit returns a Plugin which waits until it is within all of the
+// concurrency limits before calling the handler, giving up if the context is done.
+// Nil limits are ignored, those given are always acquired in the same order,
+// which should be the narrowest first, so that a call queueing for a busy plugin
+// does not hold a place in the wider limits needed by calls to other plugins.
+func limit(handler Plugin, sems ...chan struct{}) Plugin {
+	var use []chan struct{}
+	for _, s := range sems {
+		if s != nil {
+			use = append(use, s)
+		}
+	}
+	if len(use) == 0 || handler == nil {
+		return handler
+	}
+	release := func(got []chan struct{}) {
+		for _, s := range got {
+			<-s
+		}
+	}
+	return func(ctx context.Context, in interface{}) (interface{}, error) {
+		for i, s := range use {
+			select {
+			case s <- struct{}{}:
+			case <-ctx.Done():
+				release(use[:i])
+				return nil, ctx.Err()
+			}
+		}
+		defer release(use)
+		return handler(ctx, in)
+	}
+}
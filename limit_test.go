@@ -0,0 +1,198 @@
+package glick_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+// counter returns a plugin which sleeps briefly and records the most calls running at once.
+func counter() (glick.Plugin, func() int) {
+	var mtx sync.Mutex
+	running, most := 0, 0
+	return func(ctx context.Context, in interface{}) (interface{}, error) {
+			mtx.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mtx.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mtx.Lock()
+			running--
+			mtx.Unlock()
+			return Tov(ctx, in)
+		}, func() int {
+			mtx.Lock()
+			defer mtx.Unlock()
+			return most
+		}
+}
+
+// runMany runs an action n times at once, returning the number of errors.
+func runMany(l *glick.Library, api, action string, n int) int {
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	errs := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Run(nil, api, action, 1); err != nil {
+				mtx.Lock()
+				errs++
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestLimit(t *testing.T) {
+	if _, err := glick.New(nil, glick.GlobalLimit(-1)); err == nil {
+		t.Error("negative global limit not spotted")
+	}
+	l, nerr := glick.New(nil, glick.GlobalLimit(3))
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("bad", prototype, outTov, time.Second, glick.Limit(-1)); err == nil {
+		t.Error("negative api limit not spotted")
+	}
+	if err := l.RegAPI("abc", prototype, outTov, time.Second, glick.Limit(2)); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegAPI("xyz", prototype, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	plug, most := counter()
+	if err := l.RegPlugin("abc", "api", plug, nil); err != nil {
+		t.Error(err)
+	}
+	if errs := runMany(l, "abc", "api", 6); errs != 0 || most() != 2 {
+		t.Error("api limit not applied", errs, most())
+	}
+	plug, most = counter()
+	if err := l.RegPlugin("abc", "plugin", plug, &glick.Config{Limit: 1}); err != nil {
+		t.Error(err)
+	}
+	if errs := runMany(l, "abc", "plugin", 4); errs != 0 || most() != 1 {
+		t.Error("plugin limit not applied", errs, most())
+	}
+	if err := l.RegPlugin("abc", "bad", plug, &glick.Config{Limit: -1}); err == nil {
+		t.Error("negative plugin limit not spotted")
+	}
+	plug, most = counter()
+	if err := l.RegPlugin("xyz", "global", plug, nil); err != nil {
+		t.Error(err)
+	}
+	if errs := runMany(l, "xyz", "global", 6); errs != 0 || most() != 3 {
+		t.Error("global limit not applied", errs, most())
+	}
+}
+
+func TestLimitWait(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, 50*time.Millisecond, glick.Limit(1)); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "forever", Forever, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "go", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "abc", "forever", 1); err == nil {
+		t.Error("forever plugin did not time-out")
+	}
+	// the forever plugin still holds the only slot, so this call must wait until its own time-out
+	start := time.Now()
+	if _, err := l.Run(nil, "abc", "go", 1); err == nil || time.Since(start) > time.Second {
+		t.Error("waiting for a limit did not respect the time-out", err)
+	}
+}
+
+func TestLimitShared(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	plug, most := counter()
+	cfg := &glick.Config{Limit: 1}
+	for _, action := range []string{"one", "two"} {
+		if err := l.RegPlugin("abc", action, plug, cfg); err != nil {
+			t.Error(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for _, action := range []string{"one", "two"} {
+		wg.Add(1)
+		go func(action string) {
+			defer wg.Done()
+			if errs := runMany(l, "abc", action, 3); errs != 0 {
+				t.Error(errs, "errors")
+			}
+		}(action)
+	}
+	wg.Wait()
+	if most() != 1 {
+		t.Error("plugin limit not shared by its actions", most())
+	}
+}
+
+func TestLimitBulkhead(t *testing.T) {
+	l, nerr := glick.New(nil, glick.GlobalLimit(2))
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegAPI("xyz", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	plug, _ := counter()
+	if err := l.RegPlugin("abc", "busy", plug, &glick.Config{Limit: 1}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("xyz", "other", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		runMany(l, "abc", "busy", 3)
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond) // so that two calls queue for the busy plugin
+	start := time.Now()
+	if _, err := l.Run(nil, "xyz", "other", 1); err != nil {
+		t.Error(err)
+	}
+	if d := time.Since(start); d > 15*time.Millisecond {
+		t.Error("calls queueing for a busy plugin blocked another plugin for", d)
+	}
+	<-done
+}
@@ -0,0 +1,141 @@
+package glick
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatencyBuckets gives the upper bounds of the latency histogram kept for each api/action.
+var LatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second, 10 * time.Second,
+}
+
+// Stats holds the metrics for the calls to an api/action.
+type Stats struct {
+	API, Action string
+	Overloaded  bool          // the calls were to a handler chosen by the overloader
+	Calls       int64         // the number of calls
+	Errors      int64         // the number of calls which returned an error
+	Timeouts    int64         // the number of those errors which were time-outs
+	Latency     time.Duration // the total time taken by the calls
+	Buckets     []int64       // the number of calls taking at most each of the LatencyBuckets
+}
+
+type statkey struct {
+	api, action string
+	overloaded  bool
+}
+
+type stat struct {
+	calls, errors, timeouts int64
+	latency                 time.Duration
+	buckets                 []int64
+}
+
+// observe records the outcome of a call in the library metrics.
+func (l *Library) observe(c call, took time.Duration, err error) {
+	l.smtx.Lock()
+	defer l.smtx.Unlock()
+	key := statkey{c.api, c.action, c.overloaded || c.rerouted}
+	s, found := l.stats[key]
+	if !found {
+		s = &stat{buckets: make([]int64, len(LatencyBuckets))}
+		l.stats[key] = s
+	}
+	s.calls++
+	s.latency += took
+	if err != nil {
+		s.errors++
+		if IsErrClass(err, ErrClassTimeout) {
+			s.timeouts++
+		}
+	}
+	for i, b := range LatencyBuckets {
+		if took <= b {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Stats returns a snapshot of the metrics for every api/action called,
+// sorted by api, action and then whether the handler was overloaded.
+// Calls served by fallback actions are counted against the fallback action.
+func (l *Library) Stats() []Stats {
+	if l == nil {
+		return nil
+	}
+	l.smtx.Lock()
+	defer l.smtx.Unlock()
+	ret := make([]Stats, 0, len(l.stats))
+	for k, s := range l.stats {
+		ret = append(ret, Stats{API: k.api, Action: k.action, Overloaded: k.overloaded,
+			Calls: s.calls, Errors: s.errors, Timeouts: s.timeouts, Latency: s.latency,
+			Buckets: append([]int64(nil), s.buckets...)})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].API != ret[j].API {
+			return ret[i].API < ret[j].API
+		}
+		if ret[i].Action != ret[j].Action {
+			return ret[i].Action < ret[j].Action
+		}
+		return !ret[i].Overloaded && ret[j].Overloaded
+	})
+	return ret
+}
+
+// MetricsHandler returns an http.Handler which serves the library metrics
+// in the Prometheus text exposition format.
+func (l *Library) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		stats := l.Stats()
+		counter := func(name, help string, val func(Stats) int64) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+			for _, s := range stats {
+				fmt.Fprintf(w, "%s{%s} %d\n", name, promLabels(s), val(s))
+			}
+		}
+		counter("glick_calls_total", "Calls to glick plugins.",
+			func(s Stats) int64 { return s.Calls })
+		counter("glick_errors_total", "Calls to glick plugins which returned an error.",
+			func(s Stats) int64 { return s.Errors })
+		counter("glick_timeouts_total", "Calls to glick plugins which timed-out.",
+			func(s Stats) int64 { return s.Timeouts })
+		name := "glick_latency_seconds"
+		fmt.Fprintf(w, "# HELP %s Latency of calls to glick plugins.\n# TYPE %s histogram\n", name, name)
+		for _, s := range stats {
+			labels := promLabels(s)
+			for i, b := range LatencyBuckets {
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels,
+					strconv.FormatFloat(b.Seconds(), 'g', -1, 64), s.Buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, s.Calls)
+			fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels,
+				strconv.FormatFloat(s.Latency.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, s.Calls)
+		}
+		name = "glick_abandoned_calls"
+		fmt.Fprintf(w, "# HELP %s Calls to glick plugins which timed-out but are still running.\n# TYPE %s gauge\n%s %d\n",
+			name, name, name, l.Abandoned())
+	})
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels gives the Prometheus labels for the metrics of an api/action.
+func promLabels(s Stats) string {
+	handler := "registered"
+	if s.Overloaded {
+		handler = "overloaded"
+	}
+	return fmt.Sprintf(`api="%s",action="%s",handler="%s"`,
+		promEscaper.Replace(s.API), promEscaper.Replace(s.Action), handler)
+}
@@ -0,0 +1,109 @@
+package glick_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestMetrics(t *testing.T) {
+	l, nerr := glick.New(func(ctx context.Context, api, act string, handler glick.Plugin) (context.Context, glick.Plugin, error) {
+		if act == "ov" {
+			return ctx, Tov, nil
+		}
+		return ctx, nil, nil
+	})
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, 20*time.Millisecond); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "ov", Def, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "bad", JustBad, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "forever", Forever, nil); err != nil {
+		t.Error(err)
+	}
+	for _, act := range []string{"ov", "ov", "bad", "forever"} {
+		if _, err := l.Run(nil, "abc", act, 1); err != nil && act == "ov" {
+			t.Error(err)
+		}
+	}
+	stats := l.Stats()
+	if len(stats) != 3 {
+		t.Errorf("wrong stats %#v", stats)
+		return
+	}
+	if s := stats[0]; s.Action != "bad" || s.Calls != 1 || s.Errors != 1 || s.Timeouts != 0 {
+		t.Errorf("wrong error stats %#v", s)
+	}
+	if s := stats[1]; s.Action != "forever" || s.Errors != 1 || s.Timeouts != 1 || s.Latency < 20*time.Millisecond {
+		t.Errorf("wrong time-out stats %#v", s)
+	}
+	if s := stats[2]; s.Action != "ov" || !s.Overloaded || s.Calls != 2 || s.Errors != 0 ||
+		s.Buckets[len(s.Buckets)-1] != 2 {
+		t.Errorf("wrong overloaded stats %#v", s)
+	}
+
+	rec := httptest.NewRecorder()
+	l.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	b, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	body := string(b)
+	for _, want := range []string{
+		"# TYPE glick_calls_total counter\n",
+		`glick_calls_total{api="abc",action="ov",handler="overloaded"} 2` + "\n",
+		`glick_timeouts_total{api="abc",action="forever",handler="registered"} 1` + "\n",
+		"# TYPE glick_latency_seconds histogram\n",
+		`glick_latency_seconds_bucket{api="abc",action="ov",handler="overloaded",le="0.005"} 2` + "\n",
+		`glick_latency_seconds_bucket{api="abc",action="bad",handler="registered",le="+Inf"} 1` + "\n",
+		`glick_latency_seconds_count{api="abc",action="forever",handler="registered"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsOverloadedClosure(t *testing.T) {
+	constant := func(v bool) glick.Plugin {
+		return func(ctx context.Context, in interface{}) (interface{}, error) {
+			return &v, nil
+		}
+	}
+	l, nerr := glick.New(func(ctx context.Context, api, act string, handler glick.Plugin) (context.Context, glick.Plugin, error) {
+		return ctx, constant(false), nil // made by the same function as the registered handler
+	})
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "act", constant(true), nil); err != nil {
+		t.Error(err)
+	}
+	if r := l.Call(nil, "abc", "act", 1); r.Err != nil || *r.Out.(*bool) || !r.Overloaded {
+		t.Error("overloaded closure not recorded", r)
+	}
+	if s := l.Stats(); len(s) != 1 || !s[0].Overloaded {
+		t.Errorf("unexpected stats %#v", s)
+	}
+}
@@ -0,0 +1,60 @@
+package glick
+
+// Middleware wraps a Plugin with cross-cutting code, for example to log,
+// authorise or meter calls, in the style of func(Plugin) Plugin.
+// It is told which api and action it is wrapping, so that one Middleware
+// can serve many plugins.
+type Middleware func(api, action string, handler Plugin) Plugin
+
+// Use installs Middleware to wrap every plugin call on the library.
+// Global Middleware wraps outside of any Middleware installed for an API,
+// and the first Middleware given is the outermost.
+func (l *Library) Use(mw ...Middleware) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, m := range mw {
+		if m == nil {
+			return errNoPlug("nil middleware")
+		}
+	}
+	l.mws = append(l.mws, mw...)
+	return nil
+}
+
+// UseAPI installs Middleware to wrap every plugin call on the given api,
+// inside of any global Middleware installed using Use().
+// The first Middleware given is the outermost.
+func (l *Library) UseAPI(api string, mw ...Middleware) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	def, found := l.apim[api]
+	if !found {
+		return errNoAPI(api)
+	}
+	for _, m := range mw {
+		if m == nil {
+			return errNoPlug("nil middleware for api " + api)
+		}
+	}
+	def.mws = append(def.mws, mw...)
+	l.apim[api] = def
+	return nil
+}
+
+// wrap the handler chosen for an api/action with the library Middleware
+// and then the Middleware for that api, so the first global Middleware is called first.
+func wrap(api, action string, handler Plugin, libMws, apiMws []Middleware) Plugin {
+	for i := len(apiMws) - 1; i >= 0; i-- {
+		handler = apiMws[i](api, action, handler)
+	}
+	for i := len(libMws) - 1; i >= 0; i-- {
+		handler = libMws[i](api, action, handler)
+	}
+	return handler
+}
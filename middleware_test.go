@@ -0,0 +1,75 @@
+package glick_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestMiddleware(t *testing.T) {
+	l, nerr := glick.New(func(ctx context.Context, api, act string, handler glick.Plugin) (context.Context, glick.Plugin, error) {
+		if act == "ov" {
+			return ctx, Tov, nil
+		}
+		return ctx, nil, nil
+	})
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	var order []string
+	mark := func(name string) glick.Middleware {
+		return func(api, action string, handler glick.Plugin) glick.Plugin {
+			return func(ctx context.Context, in interface{}) (interface{}, error) {
+				order = append(order, name+":"+api+"/"+action)
+				return handler(ctx, in)
+			}
+		}
+	}
+	if err := l.UseAPI("abc", mark("api")); err == nil {
+		t.Error("unknown api not spotted")
+	}
+	if err := l.Use(nil); err == nil {
+		t.Error("nil middleware not spotted")
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.Use(mark("g1"), mark("g2")); err != nil {
+		t.Error(err)
+	}
+	if err := l.UseAPI("abc", mark("api")); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "default", Def, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := l.Run(nil, "abc", "default", 1); err != nil {
+		t.Error(err)
+	}
+	want := []string{"g1:abc/default", "g2:abc/default", "api:abc/default"}
+	if len(order) != len(want) {
+		t.Errorf("wrong middleware calls %v", order)
+		return
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("wrong middleware order %v", order)
+		}
+	}
+	order = nil
+	if ret, err := l.Run(nil, "abc", "ov", 1); err != nil {
+		t.Error(err)
+	} else if !*ret.(*bool) || len(order) != 3 {
+		t.Error("overloaded handler not wrapped by middleware")
+	}
+	order = nil
+	if _, err := l.Run(nil, "abc", "missing", 1); err == nil || len(order) != 0 {
+		t.Error("missing plugin should not run middleware")
+	}
+}
@@ -0,0 +1,136 @@
+package glick
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// PanicError is returned when a plugin panics, rather than crashing the process.
+type PanicError struct {
+	API, Action string
+	Value       interface{} // the value passed to panic
+	Stack       []byte      // the stack of the plugin goroutine when it panicked
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("plugin for api %s action %s panicked: %v", e.API, e.Action, e.Value)
+}
+
+// QuarantinePolicy describes when a plugin which panics repeatedly is quarantined.
+type QuarantinePolicy struct {
+	Panics int      // the number of panics within the Window which quarantine a plugin.
+	Window Duration // the time over which panics are counted.
+	For    Duration // how long a plugin is quarantined, until it is registered again if zero.
+}
+
+// Quarantine sets the QuarantinePolicy for the plugins of the library.
+// Calls to a quarantined plugin fail fast with a QuarantinedError, so that any fallback actions are used.
+func Quarantine(qp QuarantinePolicy) Option {
+	return func(l *Library) error {
+		if qp.Panics <= 0 || qp.Window <= 0 || qp.For < 0 {
+			return errors.New("quarantine policy panics and window must be positive and for not negative")
+		}
+		l.qpolicy = &qp
+		return nil
+	}
+}
+
+// QuarantinedError is returned, without running the plugin, when it has been quarantined.
+type QuarantinedError struct {
+	API, Action string
+	Until       time.Time // the zero time if until the plugin is registered again
+}
+
+func (e *QuarantinedError) Error() string {
+	if e.Until.IsZero() {
+		return fmt.Sprintf("plugin for api %s action %s is quarantined", e.API, e.Action)
+	}
+	return fmt.Sprintf("plugin for api %s action %s is quarantined until %s",
+		e.API, e.Action, e.Until.Format(time.RFC3339))
+}
+
+// panics records the recent panics of a plugin.
+type panics struct {
+	times       []time.Time // within the window
+	quarantined bool
+	until       time.Time
+}
+
+// recovered returns the PanicError for a value recovered from a plugin, or nil if there was no panic.
+func recovered(api, action string, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	return &PanicError{API: api, Action: action, Value: v, Stack: debug.Stack()}
+}
+
+// panicked records the panic of a plugin, quarantining it if the policy says so.
+// Each of the weighted plugins for an api/action is quarantined separately.
+func (l *Library) panicked(key healthKey) {
+	qp := l.qpolicy
+	if qp == nil {
+		return
+	}
+	l.qmtx.Lock()
+	defer l.qmtx.Unlock()
+	p := l.panics[key]
+	if p == nil {
+		p = &panics{}
+		l.panics[key] = p
+	}
+	now := time.Now()
+	recent := p.times[:0]
+	for _, t := range p.times {
+		if now.Sub(t) < time.Duration(qp.Window) {
+			recent = append(recent, t)
+		}
+	}
+	p.times = append(recent, now)
+	if len(p.times) >= qp.Panics {
+		p.quarantined, p.times = true, nil
+		p.until = time.Time{}
+		if qp.For > 0 {
+			p.until = now.Add(time.Duration(qp.For))
+		}
+	}
+}
+
+// quarantined returns a QuarantinedError if the plugin for the api/action is quarantined.
+func (l *Library) quarantined(api, action string, variant int) error {
+	if l.qpolicy == nil {
+		return nil
+	}
+	l.qmtx.Lock()
+	defer l.qmtx.Unlock()
+	p := l.panics[healthKey{plugkey{api, action}, variant}]
+	if p == nil || !p.quarantined {
+		return nil
+	}
+	if !p.until.IsZero() && time.Now().After(p.until) {
+		p.quarantined = false
+		return nil
+	}
+	return &QuarantinedError{API: api, Action: action, Until: p.until}
+}
+
+// forgetPanics removes the panics of the plugins for an api/action which has been replaced, ending any quarantine.
+func (l *Library) forgetPanics(key plugkey) {
+	l.qmtx.Lock()
+	for pk := range l.panics {
+		if pk.plugkey == key {
+			delete(l.panics, pk)
+		}
+	}
+	l.qmtx.Unlock()
+}
+
+// Abandoned returns the number of calls to plugins which timed-out but are still running.
+func (l *Library) Abandoned() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.orphans)
+}
@@ -0,0 +1,120 @@
+package glick_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func Panic(ctx context.Context, in interface{}) (interface{}, error) {
+	panic("oops")
+}
+
+func TestPanic(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("panic", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("panic", "panic", Panic, &glick.Config{Fallback: []string{"ok"}, FallbackOn: []string{"panic"}}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("panic", "ok", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("panic", "alone", Panic, nil); err != nil {
+		t.Error(err)
+	}
+	_, err := l.Run(nil, "panic", "alone", 1)
+	var pe *glick.PanicError
+	if !errors.As(err, &pe) {
+		t.Error("panic not returned as an error", err)
+	} else if pe.API != "panic" || pe.Action != "alone" || pe.Value != "oops" ||
+		!strings.Contains(string(pe.Stack), "Panic") {
+		t.Errorf("unexpected panic error %#v", pe)
+	}
+	if r := l.Call(nil, "panic", "panic", 1); r.Err != nil || r.Action != "ok" {
+		t.Error("fallback on panic did not work", r.Err)
+	}
+}
+
+func TestAbandoned(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("abandon", 1, outTov, 10*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+	release := make(chan struct{})
+	if err := l.RegPlugin("abandon", "stuck", func(ctx context.Context, in interface{}) (interface{}, error) {
+		<-release // ignores its context
+		return Tov(ctx, in)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := l.Run(nil, "abandon", "stuck", 1); err == nil {
+			t.Error("stuck plugin did not time-out")
+		}
+	}
+	if n := l.Abandoned(); n != 3 {
+		t.Errorf("%d abandoned calls, wanted 3", n)
+	}
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	if n := l.Abandoned(); n != 0 {
+		t.Errorf("%d abandoned calls after release, wanted 0", n)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	if _, err := glick.New(nil, glick.Quarantine(glick.QuarantinePolicy{})); err == nil {
+		t.Error("bad quarantine policy not spotted")
+	}
+	l, nerr := glick.New(nil, glick.Quarantine(glick.QuarantinePolicy{
+		Panics: 2, Window: glick.Duration(time.Minute), For: glick.Duration(50 * time.Millisecond)}))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("panic", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	calls := 0
+	if err := l.RegPlugin("panic", "panic", func(ctx context.Context, in interface{}) (interface{}, error) {
+		calls++
+		return Panic(ctx, in)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := l.Run(nil, "panic", "panic", 1); err == nil {
+			t.Error("no error from panicking plugin")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("quarantined plugin called %d times, wanted 2", calls)
+	}
+	_, err := l.Run(nil, "panic", "panic", 1)
+	var qe *glick.QuarantinedError
+	if !errors.As(err, &qe) || !glick.IsErrClass(err, glick.ErrClassUnavailable) {
+		t.Error("quarantined error not returned", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := l.Run(nil, "panic", "panic", 1); !errors.As(err, new(*glick.PanicError)) {
+		t.Error("plugin not released from quarantine", err)
+	}
+	if err := l.RegPlugin("panic", "panic", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "panic", "panic", 1); err != nil {
+		t.Error("re-registered plugin still quarantined", err)
+	}
+}
@@ -3,10 +3,11 @@ package glick
 import (
 	"errors"
 	"fmt"
-	"os/exec"
 	"reflect"
+	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/context"
@@ -48,42 +49,108 @@ type plugOut struct {
 
 // Overloader allows the standard system settings for an API
 // to be overloaded, depending on the context passed in.
+// It should return a nil Plugin to run the handler registered for the action,
+// any other Plugin returned is run in its place and the call counted as overloaded.
 type Overloader func(ctx context.Context, api, action string, handler Plugin) (context.Context, Plugin, error)
 type plugkey struct {
 	api, action string // the strings to choose a plugin
 }
 type plugval struct {
-	plug Plugin
-	cfg  *Config
+	plug     Plugin
+	cfg      *Config
+	fb       fallback       // actions to try if this one fails
+	retry    *RetryPolicy   // how to retry this plugin, if not the policy of the api
+	breaker  *BreakerPolicy // when to stop calling this plugin, if not the policy of the api
+	sem      chan struct{}  // limits how many calls to this plugin run at once
+	rate     *RatePolicy    // how often this plugin may be called, if not the policy of the api
+	probe    Probe          // checks the health of this plugin
+	cache    *cache         // the results of calls to this plugin, overriding the cache of the api
+	shadow   *ShadowPolicy  // the action to mirror calls to this plugin to
+	timeout  time.Duration  // how long before we abort, if not the timeout of the api
+	weight   int            // the share of calls to this plugin, if weighted
+	weighted []plugval      // all the weighted plugins backing the api/action, including this one
+	variant  int            // the index of this plugin in weighted, in the order registered
 }
 type plugmap map[plugkey]plugval
 type apidef struct {
-	ppi        interface{}   // a prototype of the input type
-	ppo        ProtoPlugOut  // a function returning a prototype of the output type
-	ppiT, ppoT reflect.Type  // a cached version of reflect.TypeOf the input and output types
-	timeout    time.Duration // how long before we abort
+	ppi        interface{}    // a prototype of the input type
+	ppo        ProtoPlugOut   // a function returning a prototype of the output type
+	ppiT, ppoT reflect.Type   // a cached version of reflect.TypeOf the input and output types
+	timeout    time.Duration  // how long before we abort
+	mws        []Middleware   // middleware to wrap every plugin call on this api
+	retry      *RetryPolicy   // how to retry the plugins of this api
+	breaker    *BreakerPolicy // when to stop calling the plugins of this api
+	sem        chan struct{}  // limits how many calls to this api run at once
+	rate       *RatePolicy    // how often the plugins of this api may be called
+	cache      *cache         // the results of calls to the plugins of this api
+	flights    *flights       // the calls in flight to the plugins of this api, if they are coalesced
+	compat     []int          // the versions of this api whose plugins can serve calls to it
+	inVal      []Validator    // check the input to the plugins of this api
+	outVal     []Validator    // check the output from the plugins of this api
 }
 type apimap map[string]apidef
 type cfgmap map[string]Configurator
 
 // Library holds the registered API and plugin database.
 type Library struct {
-	pim      plugmap      // a map of known plugins
-	apim     apimap       // a map of known APIs
-	cfgm     cfgmap       // a map of know configuration handlers
-	mtx      sync.RWMutex // mutex to protect map access
-	ovfn     Overloader   // the function to call to overload which plugin to use at runtime
-	subprocs []*exec.Cmd  // a slice of sub-processes created
+	pim      plugmap                      // a map of known plugins
+	apim     apimap                       // a map of known APIs
+	cfgm     cfgmap                       // a map of know configuration handlers
+	mtx      sync.RWMutex                 // mutex to protect map access
+	ovfn     Overloader                   // the function to call to overload which plugin to use at runtime
+	subprocs []subproc                    // a slice of sub-processes created
+	mws      []Middleware                 // middleware to wrap every plugin call
+	base     plugmap                      // plugins as they were before the configuration changed them
+	touched  map[plugkey]struct{}         // plugins changed while staging a configuration
+	parallel int                          // how many plugins RunAll() runs at once
+	breakers map[healthKey]*breaker       // the circuit breakers for each plugin
+	bmtx     sync.Mutex                   // mutex to protect the circuit breakers map
+	sem      chan struct{}                // limits how many plugins run at once
+	identity func(context.Context) string // gives the identity of the caller from the context
+	sticky   func(context.Context) string // gives the key to choose between weighted plugins
+	ctxkeys  map[string]interface{}       // the context keys for the names used in rules, if set-up
+	rules    map[string][]Rule            // the rules for rerouting calls, by api
+	compare  Comparator                   // reports on shadow calls
+	buckets  map[string]*bucket           // the rate limit token buckets
+	rmtx     sync.Mutex                   // mutex to protect the token buckets map
+	rsweep   int                          // the number of token buckets at which idle ones are next removed
+	stats    map[statkey]*stat            // the metrics for each api/action
+	smtx     sync.Mutex                   // mutex to protect the metrics map
+	tracer   Tracer                       // called with the span of each call
+	sinks    []EventSink                  // called with each lifecycle event
+	emtx     sync.RWMutex                 // mutex to protect the event sinks
+	health   map[healthKey]HealthReport   // the last health check of each plugin
+	hmtx     sync.Mutex                   // mutex to protect the health map
+	qpolicy  *QuarantinePolicy            // when to quarantine plugins which panic
+	panics   map[healthKey]*panics        // the recent panics of each plugin
+	qmtx     sync.Mutex                   // mutex to protect the panics map
+	orphans  int64                        // the number of timed-out calls still running, accessed atomically
+	shadows  chan struct{}                // limits how many shadow calls run at once
+	discards []func()                     // undo what the Configurators started, if a staged configuration fails
 }
 
+// APIOption sets an optional feature of an API when it is registered by RegAPI().
+type APIOption func(*apidef) error
+
+// Option sets an optional feature of a Library when it is created by New().
+type Option func(*Library) error
+
 // New returns an initialized Library.
-func New(ov Overloader) (*Library, error) {
+func New(ov Overloader, opts ...Option) (*Library, error) {
 	lib := &Library{
 		apim:     make(apimap),
 		pim:      make(plugmap),
 		cfgm:     make(cfgmap),
 		ovfn:     ov,
-		subprocs: make([]*exec.Cmd, 0),
+		subprocs: make([]subproc, 0),
+		base:     make(plugmap),
+		parallel: runtime.NumCPU(),
+		breakers: make(map[healthKey]*breaker),
+		buckets:  make(map[string]*bucket),
+		stats:    make(map[statkey]*stat),
+		health:   make(map[healthKey]HealthReport),
+		panics:   make(map[healthKey]*panics),
+		shadows:  make(chan struct{}, defaultShadows),
 	}
 	if err := ConfigCmd(lib); err != nil {
 		return nil, err
@@ -94,16 +161,30 @@ func New(ov Overloader) (*Library, error) {
 	if err := ConfigRPC(lib); err != nil {
 		return nil, err
 	}
+	for _, opt := range opts {
+		if err := opt(lib); err != nil {
+			return nil, err
+		}
+	}
 	return lib, nil
 }
 
 // RegAPI allows registration of a named API.
 // The in/out prototype defines the type that must be passed in and out.
-// The timeout gives the maximum time that a Plugin using this API may take to execute.
-func (l *Library) RegAPI(api string, inPrototype interface{}, outPlugProto ProtoPlugOut, timeout time.Duration) error {
+// The timeout gives the maximum time that a Plugin using this API may take to execute,
+// zero for no limit; the Timeout of a plugin Config, or WithPluginTimeout(), override it.
+func (l *Library) RegAPI(api string, inPrototype interface{}, outPlugProto ProtoPlugOut, timeout time.Duration, opts ...APIOption) error {
 	if l == nil {
 		return ErrNilLib
 	}
+	if err := l.regAPI(api, inPrototype, outPlugProto, timeout, opts); err != nil {
+		return err
+	}
+	l.emit(Event{Kind: EventRegAPI, API: api})
+	return nil
+}
+
+func (l *Library) regAPI(api string, inPrototype interface{}, outPlugProto ProtoPlugOut, timeout time.Duration, opts []APIOption) error {
 	l.mtx.Lock()
 	defer l.mtx.Unlock()
 	if inPrototype == nil || outPlugProto == nil || outPlugProto() == nil {
@@ -112,9 +193,18 @@ func (l *Library) RegAPI(api string, inPrototype interface{}, outPlugProto Proto
 	if _, found := l.apim[api]; found {
 		return errDupAPI(api)
 	}
-	l.apim[api] = apidef{inPrototype, outPlugProto,
-		reflect.TypeOf(inPrototype), reflect.TypeOf(outPlugProto()),
-		timeout}
+	def := apidef{ppi: inPrototype, ppo: outPlugProto,
+		ppiT: reflect.TypeOf(inPrototype), ppoT: reflect.TypeOf(outPlugProto()),
+		timeout: timeout}
+	for _, opt := range opts {
+		if err := opt(&def); err != nil {
+			return err
+		}
+	}
+	if err := checkVersion(api, def); err != nil {
+		return err
+	}
+	l.apim[api] = def
 	return nil
 }
 
@@ -124,16 +214,88 @@ func (l *Library) RegPlugin(api, action string, handler Plugin, cfg *Config) err
 	if l == nil {
 		return ErrNilLib
 	}
+	overload, err := l.regPlugin(api, action, handler, cfg)
+	if err != nil {
+		return err
+	}
+	l.emit(Event{Kind: EventRegPlugin, API: api, Action: action, Overload: overload, Config: redact(cfg)})
+	return nil
+}
+
+// regPlugin registers a plugin, returning true if it overloads an existing one.
+func (l *Library) regPlugin(api, action string, handler Plugin, cfg *Config) (overload bool, err error) {
 	l.mtx.Lock()
 	defer l.mtx.Unlock()
 	if _, hasAPI := l.apim[api]; !hasAPI {
-		return errNoAPI(api)
+		return false, errNoAPI(api)
 	}
 	if handler == nil {
-		return errNoPlug("nil handler for api " + api)
+		return false, errNoPlug("nil handler for api " + api)
 	}
-	l.pim[plugkey{api, action}] = plugval{handler, cfg}
-	return nil
+	pv := plugval{plug: handler, cfg: cfg}
+	if cfg != nil {
+		fb, err := newFallback(cfg.Fallback, cfg.FallbackOn)
+		if err != nil {
+			return false, err
+		}
+		pv.fb = fb
+		if cfg.Retry != nil {
+			if err := cfg.Retry.validate(); err != nil {
+				return false, err
+			}
+			pv.retry = cfg.Retry
+		}
+		if cfg.Breaker != nil {
+			if err := cfg.Breaker.validate(); err != nil {
+				return false, err
+			}
+			pv.breaker = cfg.Breaker
+		}
+		if cfg.Limit < 0 {
+			return false, errLimit
+		}
+		if cfg.Limit > 0 {
+			if cap(cfg.sem) != cfg.Limit {
+				cfg.sem = make(chan struct{}, cfg.Limit)
+			}
+			pv.sem = cfg.sem // shared by every action using this Config
+		}
+		if cfg.Rate != nil {
+			if err := cfg.Rate.validate(); err != nil {
+				return false, err
+			}
+			pv.rate = cfg.Rate
+		}
+		if cfg.Cache != nil {
+			c, err := newCache(*cfg.Cache)
+			if err != nil {
+				return false, err
+			}
+			pv.cache = c
+		}
+		if cfg.Shadow != nil {
+			if err := cfg.Shadow.validate(); err != nil {
+				return false, err
+			}
+			pv.shadow = cfg.Shadow
+		}
+		if cfg.Timeout < 0 {
+			return false, errors.New("plugin timeout must not be negative")
+		}
+		pv.timeout = time.Duration(cfg.Timeout)
+		if cfg.Weight < 0 {
+			return false, errWeight
+		}
+		pv.weight = cfg.Weight
+	}
+	key := plugkey{api, action}
+	_, overload = l.pim[key]
+	l.pim[key] = l.weigh(key, pv)
+	l.registered(key)
+	l.forgetHealth(key)
+	l.forgetPanics(key)
+	l.forgetBreaker(key)
+	return overload, nil
 }
 
 func (l *Library) def(ctx context.Context, api, action string, in interface{}) (apidef, error) {
@@ -153,61 +315,215 @@ func (l *Library) def(ctx context.Context, api, action string, in interface{}) (
 }
 
 // Run a plugin for a given action on an API, passing data in/out.
+// The API may give a version constraint, in which case the best version is run, see VersionSep.
 // The library overloader function may decide from the context that a non-standard
-// action should be run.
+// action should be run, the handler chosen is then wrapped by any Middleware.
+// The library is not locked while the plugin runs, so it may be reconfigured meanwhile.
 func (l *Library) Run(ctx context.Context, api, action string, in interface{}) (out interface{}, err error) {
+	r := l.Call(ctx, api, action, in)
+	return r.Out, r.Err
+}
+
+// Call runs a plugin in the same way as Run(), but returns a Result which also gives
+// the api version and action that served the request, which differ from those asked for
+// if another version was resolved, if a Rule rerouted the call, or if the plugin failed and a fallback action was used.
+// A trace span is started for the call, see WithTraceParent() and Trace().
+func (l *Library) Call(ctx context.Context, api, action string, in interface{}) (r Result) {
 	if l == nil {
-		return nil, ErrNilLib
+		return Result{Err: ErrNilLib}
 	}
 	l.mtx.RLock()
-	defer l.mtx.RUnlock()
-
+	api = l.resolve(api, action, in)
 	def, err := l.def(ctx, api, action, in)
+	pv, found := l.pim[plugkey{api, action}]
+	mws := l.mws
+	l.mtx.RUnlock()
 	if err != nil {
-		return nil, err
+		return Result{Err: err}
+	}
+	if err := validate(def.inVal, api, action, false, in); err != nil {
+		return Result{API: api, Action: action, Err: err}
 	}
 
 	if ctx == nil || ctx == context.TODO() {
 		ctx = context.Background()
 	}
+	ctx, finish := l.startSpan(ctx, api, action)
+	l.emit(Event{Kind: EventRunStart, API: api, Action: action})
+	defer func(start time.Time) {
+		finish(r)
+		l.emit(Event{Kind: EventRunFinish, API: api, Action: action, Served: r.Action,
+			Overloaded: r.Overloaded, Duration: time.Since(start), Err: r.Err})
+	}(time.Now())
 
+	c := l.reroute(ctx, call{api: api, action: action, def: def, mws: mws, in: in})
+	if !c.rerouted {
+		c.pv = l.choose(ctx, api, action, pv)
+	}
 	var handler Plugin
-	pv, found := l.pim[plugkey{api, action}]
-	if found {
-		handler = pv.plug
+	if found || c.rerouted {
+		handler = c.pv.plug
 	}
 
 	// should this run call and overload function?
-	if l.ovfn != nil {
+	if l.ovfn != nil && !c.rerouted {
 		var ovHandler Plugin
 		var ovErr error
 		ctx, ovHandler, ovErr = l.ovfn(ctx, api, action, handler)
 		if ovErr != nil {
-			return nil, ovErr
+			return Result{Err: ovErr}
 		}
 		if ovHandler != nil {
+			c.overloaded = true
 			handler = ovHandler
-			found = true
 		}
 	}
 
-	return l.run(ctx, api, found, handler, def, in)
+	start := time.Now()
+	r = Result{API: api, Action: c.action, Overloaded: c.overloaded || c.rerouted}
+	r.Out, r.Err = l.attempt(ctx, c, handler)
+	if r.Err != nil {
+		r = l.fallback(ctx, c, r)
+	}
+	if sp := c.pv.shadow; sp != nil && sp.sampled() {
+		l.shadow(ctx, c, r, time.Since(start))
+	}
+	return r
+}
+
+// call holds the details of a call to a plugin as it passes through the library.
+type call struct {
+	api, action string
+	pv          plugval      // the plugin registered for the api/action
+	def         apidef       // the definition of the api
+	mws         []Middleware // the library Middleware
+	in          interface{}  // the data passed in
+	overloaded  bool         // the overloader chose a different handler to the one registered
+	rerouted    bool         // a Rule chose the action run in place of the one called
+	shadow      bool         // a shadow call, see ShadowPolicy
+}
+
+// attempt runs the handler for an action, using any cached result
+// and sharing identical calls in flight if the API coalesces them.
+// The outcome of each call to the plugin is recorded in the library metrics.
+func (l *Library) attempt(ctx context.Context, c call, handler Plugin) (out interface{}, err error) {
+	if handler == nil {
+		return nil, errNoPlug("api " + c.api)
+	}
+	ch, key, cacheable := c.cache()
+	if cacheable {
+		if useCache(ctx) {
+			if out, hit := ch.get(key); hit {
+				return out, nil
+			}
+		}
+		defer func() {
+			if err == nil {
+				ch.put(key, out)
+			}
+		}()
+	}
+	if fs := c.def.flights; fs != nil && !c.overloaded {
+		if key, ok := l.flightKey(ctx, c); ok {
+			return fs.do(ctx, key, func(ctx context.Context) (interface{}, error) {
+				return l.invoke(ctx, c, handler)
+			})
+		}
+	}
+	return l.invoke(ctx, c, handler)
+}
+
+// invoke runs the handler for an action, if it is healthy, within its rate limit and circuit breaker,
+// retrying according to its policy within the concurrency limits and wrapped by any Middleware.
+func (l *Library) invoke(ctx context.Context, c call, handler Plugin) (out interface{}, err error) {
+	defer func(start time.Time) {
+		l.observe(c, time.Since(start), err)
+	}(time.Now())
+	api, action, pv, def := c.api, c.action, c.pv, c.def
+	timeout := c.timeout(ctx)
+	if timeout < 0 {
+		return nil, context.DeadlineExceeded
+	}
+	if err := l.quarantined(api, action, pv.variant); err != nil {
+		return nil, err
+	}
+	if err := l.healthy(api, action, pv.variant); err != nil {
+		return nil, err
+	}
+	if err := l.allow(ctx, api, action, pv, def); err != nil {
+		return nil, err
+	}
+	rp := pv.retry
+	if rp == nil {
+		rp = def.retry
+	}
+	bp := pv.breaker
+	if bp == nil {
+		bp = def.breaker
+	}
+	var b *breaker
+	var gen uint64
+	if bp != nil {
+		b = l.breaker(healthKey{plugkey{api, action}, pv.variant})
+		if gen, err = b.allow(api, action); err != nil {
+			return nil, err
+		}
+	}
+	sems, mws := []chan struct{}{pv.sem, def.sem, l.sem}, def.mws
+	if c.shadow {
+		sems, mws = sems[:1], nil // only the limit of the shadow plugin itself applies
+	}
+	out, err = l.run(ctx, api, action, wrap(api, action, rp.wrap(limit(handler, sems...)), c.mws, mws), def, timeout, c.in)
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		l.panicked(healthKey{plugkey{api, action}, pv.variant})
+	}
+	if err == nil {
+		if err = validate(def.outVal, api, action, true, out); err != nil {
+			out = nil
+		}
+	}
+	if b != nil {
+		b.record(gen, bp, err != nil, ctx.Err() != nil)
+	}
+	return out, err
 }
 
-func (l *Library) run(ctx context.Context, api string, found bool, handler Plugin, def apidef, in interface{}) (out interface{}, err error) {
-	if !found || handler == nil {
+// run the handler within the timeout, if any, checking that its output is of the right type.
+// A panic in the handler is returned as a PanicError. If the handler times-out it is left to
+// finish in the background, counted by Abandoned().
+func (l *Library) run(ctx context.Context, api, action string, handler Plugin, def apidef, timeout time.Duration, in interface{}) (out interface{}, err error) {
+	if handler == nil {
 		return nil, errNoPlug("api " + api)
 	}
-	reply := make(chan plugOut)
-	ctxWT, cancel := context.WithTimeout(ctx, l.apim[api].timeout)
+	reply := make(chan plugOut, 1) // so that an abandoned handler does not block
+	var state int32                // 0 running, 1 finished, 2 abandoned
+	var ctxWT context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctxWT, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctxWT, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
 	go func() {
-		defer cancel()
 		var plo plugOut
+		defer func() {
+			if perr := recovered(api, action, recover()); perr != nil {
+				plo.out, plo.err = nil, perr
+			}
+			if !atomic.CompareAndSwapInt32(&state, 0, 1) {
+				atomic.AddInt64(&l.orphans, -1)
+			}
+			reply <- plo
+		}()
 		plo.out, plo.err = handler(ctxWT, in)
-		reply <- plo
 	}()
 	select {
 	case <-ctxWT.Done():
+		if atomic.CompareAndSwapInt32(&state, 0, 2) {
+			atomic.AddInt64(&l.orphans, 1)
+		}
 		return nil, ctxWT.Err()
 	case plo := <-reply:
 		if plo.err == nil && (plo.out == nil ||
@@ -280,12 +596,14 @@ func (l *Library) KillSubProcs() error {
 	if l == nil {
 		return errors.New("pointer to Library is nil")
 	}
-	l.mtx.RLock()
-	defer l.mtx.RUnlock()
+	l.mtx.Lock()
+	subprocs := l.subprocs
+	l.subprocs = make([]subproc, 0)
+	l.mtx.Unlock() // so that plugins can run while the servers are stopped
 	errStr := ""
-	for _, s := range l.subprocs {
+	for _, s := range subprocs {
 		var err error
-		err = s.Process.Kill()
+		err = s.ecmd.Process.Kill()
 		if err != nil {
 			errStr += " : " + err.Error()
 		} else {
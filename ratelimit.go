@@ -0,0 +1,163 @@
+package glick
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// The keys by which a rate limit may be kept.
+const (
+	RateByAction   = "action"   // one limit for each api/action
+	RateByToken    = "token"    // one limit for each Config Token, shared by every plugin using it
+	RateByIdentity = "identity" // one limit for each api/action and caller identity, see Identity()
+)
+
+// RatePolicy describes a token-bucket rate limit.
+type RatePolicy struct {
+	Rate  float64 // the calls allowed per second, on average.
+	Burst int     // the most calls allowed at once, default the Rate rounded up.
+	By    string  // the key to keep the limit by: "action" (the default), "token" or "identity".
+}
+
+// RateLimit sets the RatePolicy for every action on an API,
+// a RatePolicy in the Config of a plugin overrides it.
+func RateLimit(rp RatePolicy) APIOption {
+	return func(def *apidef) error {
+		if err := rp.validate(); err != nil {
+			return err
+		}
+		def.rate = &rp
+		return nil
+	}
+}
+
+// Identity sets the function which gives the identity of a caller from the context,
+// for rate limits kept by identity.
+func Identity(fn func(ctx context.Context) string) Option {
+	return func(l *Library) error {
+		if fn == nil {
+			return errors.New("nil identity function")
+		}
+		l.identity = fn
+		return nil
+	}
+}
+
+func (rp *RatePolicy) validate() error {
+	if rp.Rate <= 0 || rp.Burst < 0 {
+		return errors.New("rate policy rate must be positive and burst not negative")
+	}
+	switch rp.By {
+	case "", RateByAction, RateByToken, RateByIdentity:
+		return nil
+	}
+	return errors.New("unknown rate policy key: " + rp.By)
+}
+
+func (rp *RatePolicy) burst() float64 {
+	if rp.Burst == 0 {
+		return math.Ceil(rp.Rate)
+	}
+	return float64(rp.Burst)
+}
+
+// RateLimitError is returned, without running the plugin,
+// when the rate limit for an api/action has been reached.
+type RateLimitError struct {
+	API, Action string
+	By          string // the key the limit is kept by: "action", "token" or "identity"
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit by %s reached for api %s action %s", e.By, e.API, e.Action)
+}
+
+// bucket holds the running state of a token-bucket.
+type bucket struct {
+	mtx    sync.Mutex
+	tokens float64
+	last   time.Time
+	refill time.Duration // how long the bucket takes to fill from empty
+}
+
+// minSweep is the fewest token buckets at which idle ones are removed.
+const minSweep = 64
+
+// idle returns true if the bucket has refilled since it was last used,
+// so it is the same as a new one and can be removed.
+func (b *bucket) idle(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return now.Sub(b.last) >= b.refill
+}
+
+// sweep removes the idle token buckets, once the map has doubled in size since the last sweep,
+// so that the buckets kept by identity do not grow without limit.
+// It must be called with the token buckets map locked.
+func (l *Library) sweep(now time.Time) {
+	if len(l.buckets) < l.rsweep || len(l.buckets) < minSweep {
+		return
+	}
+	for k, b := range l.buckets {
+		if b.idle(now) {
+			delete(l.buckets, k)
+		}
+	}
+	l.rsweep = 2 * len(l.buckets)
+}
+
+// take a token from the bucket, if there is one.
+func (b *bucket) take(rp *RatePolicy) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(rp.burst(), b.tokens+now.Sub(b.last).Seconds()*rp.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// allow returns a RateLimitError if the rate limit for the plugin has been reached.
+func (l *Library) allow(ctx context.Context, api, action string, pv plugval, def apidef) error {
+	rp := pv.rate
+	if rp == nil {
+		rp = def.rate
+	}
+	if rp == nil {
+		return nil
+	}
+	by, key := RateByAction, api+"/"+action
+	switch rp.By {
+	case RateByToken:
+		if pv.cfg != nil && pv.cfg.Token != "" {
+			by, key = RateByToken, pv.cfg.Token
+		}
+	case RateByIdentity:
+		if l.identity != nil {
+			by, key = RateByIdentity, api+"/"+action+"/"+l.identity(ctx)
+		}
+	}
+	key = by + ":" + key
+	now := time.Now()
+	l.rmtx.Lock()
+	b, found := l.buckets[key]
+	if !found {
+		l.sweep(now)
+		b = &bucket{tokens: rp.burst(), last: now,
+			refill: time.Duration(rp.burst() / rp.Rate * float64(time.Second))}
+		l.buckets[key] = b
+	}
+	l.rmtx.Unlock()
+	if !b.take(rp) {
+		return &RateLimitError{API: api, Action: action, By: by}
+	}
+	return nil
+}
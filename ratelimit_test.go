@@ -0,0 +1,129 @@
+package glick_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+type userKey struct{}
+
+func TestRateLimit(t *testing.T) {
+	if _, err := glick.New(nil, glick.Identity(nil)); err == nil {
+		t.Error("nil identity function not spotted")
+	}
+	l, nerr := glick.New(nil, glick.Identity(func(ctx context.Context) string {
+		s, _ := ctx.Value(userKey{}).(string)
+		return s
+	}))
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("bad", prototype, outTov, time.Second,
+		glick.RateLimit(glick.RatePolicy{})); err == nil {
+		t.Error("zero rate not spotted")
+	}
+	if err := l.RegAPI("bad", prototype, outTov, time.Second,
+		glick.RateLimit(glick.RatePolicy{Rate: 1, By: "odd"})); err == nil {
+		t.Error("unknown key not spotted")
+	}
+	if err := l.RegAPI("abc", prototype, outTov, time.Second,
+		glick.RateLimit(glick.RatePolicy{Rate: 20, Burst: 2})); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "go", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := l.Run(nil, "abc", "go", 1); err != nil {
+			t.Error(err)
+		}
+	}
+	_, err := l.Run(nil, "abc", "go", 1)
+	if rle, ok := err.(*glick.RateLimitError); !ok || rle.By != glick.RateByAction {
+		t.Error("rate limit not reached", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := l.Run(nil, "abc", "go", 1); err != nil {
+		t.Error("rate limit not refilled", err)
+	}
+
+	tokenRate := &glick.RatePolicy{Rate: 0.001, Burst: 1, By: "token"}
+	if err := l.RegPlugin("abc", "t1", Tov, &glick.Config{Token: "XYZ", Rate: tokenRate}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "t2", Tov, &glick.Config{Token: "XYZ", Rate: tokenRate}); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "abc", "t1", 1); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "abc", "t2", 1); err == nil {
+		t.Error("rate limit not shared by token")
+	}
+
+	if err := l.RegPlugin("abc", "id", Tov,
+		&glick.Config{Rate: &glick.RatePolicy{Rate: 0.001, By: "identity"}}); err != nil {
+		t.Error(err)
+	}
+	alice := context.WithValue(context.Background(), userKey{}, "alice")
+	bob := context.WithValue(context.Background(), userKey{}, "bob")
+	if _, err := l.Run(alice, "abc", "id", 1); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(bob, "abc", "id", 1); err != nil {
+		t.Error("rate limit not kept by identity", err)
+	}
+	if _, err := l.Run(alice, "abc", "id", 1); err == nil {
+		t.Error("rate limit by identity not reached")
+	}
+	if err := l.RegPlugin("abc", "bad", Tov, &glick.Config{Rate: &glick.RatePolicy{Rate: -1}}); err == nil {
+		t.Error("negative rate not spotted")
+	}
+}
+
+func TestRateLimitIdle(t *testing.T) {
+	l, nerr := glick.New(nil, glick.Identity(func(ctx context.Context) string {
+		s, _ := ctx.Value(userKey{}).(string)
+		return s
+	}))
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if err := l.RegAPI("abc", 1, outTov, time.Second,
+		glick.RateLimit(glick.RatePolicy{Rate: 2, Burst: 1, By: glick.RateByIdentity})); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.RegPlugin("abc", "go", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	run := func(user string) error {
+		_, err := l.Run(context.WithValue(context.Background(), userKey{}, user), "abc", "go", 1)
+		return err
+	}
+	if err := run("alice"); err != nil {
+		t.Error(err)
+	}
+	// many identities, so that the idle buckets are removed
+	for i := 0; i < 200; i++ {
+		if err := run(fmt.Sprint("user", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := run("alice"); err == nil {
+		t.Error("bucket in use was removed, resetting its limit")
+	}
+	time.Sleep(600 * time.Millisecond)
+	if err := run("alice"); err != nil {
+		t.Error("idle bucket did not refill", err)
+	}
+}
@@ -0,0 +1,92 @@
+package glick
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy describes how to retry a plugin which fails.
+// All of the attempts must complete within the timeout of the call.
+type RetryPolicy struct {
+	Attempts   int      // the most attempts to make, including the first.
+	Backoff    Duration // the wait before the first retry, doubled for each retry after it.
+	MaxBackoff Duration // the longest wait between attempts, if set.
+	Jitter     float64  // the fraction of each wait to randomise, from 0 to 1.
+	RetryOn    []string // the error classes to retry: "timeout","dial" or "any" (the default).
+
+	// Retryable, if set, decides which errors to retry in place of RetryOn.
+	Retryable func(error) bool `json:"-"`
+}
+
+// Retry sets the RetryPolicy for every action on an API,
+// a RetryPolicy in the Config of a plugin overrides it.
+func Retry(rp RetryPolicy) APIOption {
+	return func(def *apidef) error {
+		if err := rp.validate(); err != nil {
+			return err
+		}
+		def.retry = &rp
+		return nil
+	}
+}
+
+func (rp *RetryPolicy) validate() error {
+	if rp.Attempts < 0 || rp.Backoff < 0 || rp.MaxBackoff < 0 {
+		return errors.New("negative retry policy value")
+	}
+	if rp.Jitter < 0 || rp.Jitter > 1 {
+		return errors.New("retry policy jitter must be from 0 to 1")
+	}
+	for _, class := range rp.RetryOn {
+		if class == ErrClassUnavailable || class == ErrClassPanic {
+			// the plugin is not run when unavailable, and a panic ends the attempts
+			return errors.New("retry policy cannot retry error class: " + class)
+		}
+	}
+	_, err := newFallback(nil, rp.RetryOn) // to check the error classes
+	return err
+}
+
+// retries returns true if the error should be retried.
+func (rp *RetryPolicy) retries(err error) bool {
+	if rp.Retryable != nil {
+		return rp.Retryable(err)
+	}
+	return fallback{on: rp.RetryOn}.triggers(err)
+}
+
+// wait returns how long to wait before the given retry, counting from 1.
+func (rp *RetryPolicy) wait(retry int) time.Duration {
+	d := time.Duration(rp.Backoff)
+	for i := 1; i < retry && (rp.MaxBackoff == 0 || d < time.Duration(rp.MaxBackoff)); i++ {
+		d *= 2
+	}
+	if rp.MaxBackoff > 0 && d > time.Duration(rp.MaxBackoff) {
+		d = time.Duration(rp.MaxBackoff)
+	}
+	return d - time.Duration(rp.Jitter*rand.Float64()*float64(d))
+}
+
+// wrap returns a Plugin which retries the handler according to the policy,
+// giving up when the context is done.
+func (rp *RetryPolicy) wrap(handler Plugin) Plugin {
+	if rp == nil || rp.Attempts <= 1 || handler == nil {
+		return handler
+	}
+	return func(ctx context.Context, in interface{}) (out interface{}, err error) {
+		for attempt := 1; ; attempt++ {
+			out, err = handler(ctx, in)
+			if err == nil || attempt >= rp.Attempts || ctx.Err() != nil || !rp.retries(err) {
+				return out, err
+			}
+			select {
+			case <-ctx.Done():
+				return out, err
+			case <-time.After(rp.wait(attempt)):
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package glick_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+// flaky returns a plugin which fails the given number of times before it works.
+func flaky(fails int) (glick.Plugin, func() int) {
+	var mtx sync.Mutex
+	calls := 0
+	return func(ctx context.Context, in interface{}) (interface{}, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			calls++
+			if calls <= fails {
+				return nil, errors.New("flaky")
+			}
+			return Tov(ctx, in)
+		}, func() int {
+			mtx.Lock()
+			defer mtx.Unlock()
+			return calls
+		}
+}
+
+func TestRetry(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("bad", prototype, outTov, time.Second,
+		glick.Retry(glick.RetryPolicy{Jitter: 2})); err == nil {
+		t.Error("bad jitter not spotted")
+	}
+	if err := l.RegAPI("bad", prototype, outTov, time.Second,
+		glick.Retry(glick.RetryPolicy{RetryOn: []string{"odd"}})); err == nil {
+		t.Error("bad error class not spotted")
+	}
+	for _, class := range []string{glick.ErrClassUnavailable, glick.ErrClassPanic} {
+		if err := l.RegAPI("bad", prototype, outTov, time.Second,
+			glick.Retry(glick.RetryPolicy{RetryOn: []string{class}})); err == nil {
+			t.Error("error class which cannot be retried not spotted: " + class)
+		}
+	}
+	if err := l.RegAPI("abc", prototype, outTov, 200*time.Millisecond,
+		glick.Retry(glick.RetryPolicy{Attempts: 3, Backoff: glick.Duration(time.Millisecond), Jitter: 0.5})); err != nil {
+		t.Error(err)
+		return
+	}
+	plug, calls := flaky(2)
+	if err := l.RegPlugin("abc", "flaky", plug, nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "abc", "flaky", 1); err != nil || calls() != 3 {
+		t.Error("api retry policy did not retry", err, calls())
+	}
+	plug, calls = flaky(2)
+	if err := l.RegPlugin("abc", "once", plug,
+		&glick.Config{Retry: &glick.RetryPolicy{Attempts: 2}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "abc", "once", 1); err == nil || calls() != 2 {
+		t.Error("plugin retry policy did not override api policy", err, calls())
+	}
+	plug, calls = flaky(2)
+	if err := l.RegPlugin("abc", "dial", plug,
+		&glick.Config{Retry: &glick.RetryPolicy{Attempts: 3, RetryOn: []string{"dial"}}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "abc", "dial", 1); err == nil || calls() != 1 {
+		t.Error("non-retryable error retried", err, calls())
+	}
+	plug, calls = flaky(2)
+	if err := l.RegPlugin("abc", "slow", plug,
+		&glick.Config{Retry: &glick.RetryPolicy{Attempts: 3, Backoff: glick.Duration(time.Hour)}}); err != nil {
+		t.Error(err)
+	}
+	start := time.Now()
+	if _, err := l.Run(nil, "abc", "slow", 1); err == nil || time.Since(start) > time.Second {
+		t.Error("retry did not respect the api timeout", err)
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	var d glick.Duration
+	if err := d.UnmarshalJSON([]byte(`"1.5s"`)); err != nil || time.Duration(d) != 1500*time.Millisecond {
+		t.Error("duration string not decoded", err)
+	}
+	if err := d.UnmarshalJSON([]byte(`42`)); err != nil || d != 42 {
+		t.Error("duration number not decoded", err)
+	}
+	if err := d.UnmarshalJSON([]byte(`"forty-two"`)); err == nil {
+		t.Error("bad duration not spotted")
+	}
+	if b, err := d.MarshalJSON(); err != nil || string(b) != `"42ns"` {
+		t.Error("duration not encoded", string(b), err)
+	}
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p1","API":"string/*string","Actions":["pwd"],"Type":"CMD","Cmd":["pwd"],
+ "Retry":{"Attempts":3,"Backoff":"10ms","MaxBackoff":"1s","RetryOn":["timeout"]}}
+		]`)); err != nil {
+		t.Error(err)
+	}
+	if cfg := l.Config("string/*string", "pwd"); cfg == nil || cfg.Retry == nil ||
+		time.Duration(cfg.Retry.Backoff) != 10*time.Millisecond {
+		t.Error("retry policy not configured")
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"p2","API":"string/*string","Actions":["bad"],"Type":"CMD","Cmd":["pwd"],"Retry":{"Attempts":-1}}
+		]`)); err == nil {
+		t.Error("bad retry policy not spotted")
+	}
+}
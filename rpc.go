@@ -2,6 +2,7 @@ package glick
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/rpc"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"os/exec"
 	"reflect"
+	"strings"
 
 	"golang.org/x/net/context"
 )
@@ -19,6 +21,7 @@ var InsecureSkipVerifyTLS = false
 // PluginRPC returns a type which implements the Plugger interface for making an RPC.
 // The return type of this class of plugin must be a pointer.
 // The plugin creates a client per call to allow services to go up-and-down between calls.
+// Any traceparent in the context is passed in the TraceParent field of the input, if it has one.
 func PluginRPC(useJSON bool, serviceMethod, endPoint string, ppo ProtoPlugOut) Plugin {
 	if endPoint == "" || serviceMethod == "" ||
 		reflect.TypeOf(ppo()).Kind() != reflect.Ptr {
@@ -73,7 +76,7 @@ func PluginRPC(useJSON bool, serviceMethod, endPoint string, ppo ProtoPlugOut) P
 			return nil, errDial
 		}
 		out = ppo()
-		err = client.Call(serviceMethod, in, out)
+		err = client.Call(serviceMethod, TraceEnvelope(ctx, in), out)
 		err2 := client.Close()
 		if err == nil {
 			err = err2
@@ -95,6 +98,10 @@ func ConfigRPC(lib *Library) error {
 				return fmt.Errorf("entry %d RPC register plugin error: %v",
 					line, err)
 			}
+			if err := l.RegProbe(cfg.API, action, ProbeDial(cfg.Path)); err != nil {
+				return fmt.Errorf("entry %d RPC register probe error: %v",
+					line, err)
+			}
 		}
 		return nil
 	})
@@ -113,6 +120,18 @@ func (l rpcLog) Write(p []byte) (int, error) {
 	return len(p), err
 }
 
+// subproc records a local RPC server started by StartLocalRPCservers.
+type subproc struct {
+	plugin string    // the name of the plugin server
+	cmd    []string  // the command used to start it
+	ecmd   *exec.Cmd // the running command
+}
+
+// subprocKey identifies a local RPC server by its plugin name and command.
+func subprocKey(plugin string, cmd []string) string {
+	return plugin + "\x00" + strings.Join(cmd, "\x00")
+}
+
 func validRPC(v plugval) bool {
 	if v.cfg != nil {
 		if !v.cfg.Disabled &&
@@ -126,23 +145,31 @@ func validRPC(v plugval) bool {
 	return false
 }
 
-// StartLocalRPCservers starts up local RPC server plugins.
+// StartLocalRPCservers starts up local RPC server plugins,
+// those already started with the same command are left running.
 // TODO add tests.
 func (l *Library) StartLocalRPCservers(stdOut, stdErr io.Writer) error {
 	if l == nil {
 		return ErrNilLib
 	}
 
-	l.mtx.RLock()
-	defer l.mtx.RUnlock()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
 
 	servers := make(map[string]struct{})
+	running := make(map[string]struct{})
+	for _, s := range l.subprocs {
+		running[subprocKey(s.plugin, s.cmd)] = struct{}{}
+	}
 
 	for _, v := range l.pim {
 		if validRPC(v) {
 			_, found := servers[v.cfg.Plugin]
 			if !found {
 				servers[v.cfg.Plugin] = struct{}{}
+				if _, up := running[subprocKey(v.cfg.Plugin, v.cfg.Cmd)]; up {
+					continue
+				}
 				cmdPath, e := exec.LookPath(v.cfg.Cmd[0])
 				if e != nil {
 					return errNoPlug(v.cfg.Cmd[0] + " (error: " + e.Error() + ")")
@@ -160,9 +187,58 @@ func (l *Library) StartLocalRPCservers(stdOut, stdErr io.Writer) error {
 				if err != nil {
 					return err
 				}
-				l.subprocs = append(l.subprocs, ecmd)
+				l.subprocs = append(l.subprocs, subproc{v.cfg.Plugin, v.cfg.Cmd, ecmd})
+				go l.waitSubProc(v.cfg.Plugin, ecmd)
 			}
 		}
 	}
 	return nil
 }
+
+// waitSubProc emits the start and exit events for a local RPC server,
+// forgetting it once it exits so that StartLocalRPCservers() can start it again.
+func (l *Library) waitSubProc(plugin string, ecmd *exec.Cmd) {
+	l.emit(Event{Kind: EventSubProcStart, Plugin: plugin, Pid: ecmd.Process.Pid})
+	err := ecmd.Wait()
+	l.mtx.Lock()
+	for i, s := range l.subprocs {
+		if s.ecmd == ecmd {
+			l.subprocs = append(l.subprocs[:i], l.subprocs[i+1:]...)
+			break
+		}
+	}
+	l.mtx.Unlock()
+	l.emit(Event{Kind: EventSubProcExit, Plugin: plugin, Pid: ecmd.Process.Pid, Err: err})
+}
+
+// stopUnusedRPCservers kills the local RPC servers no longer referenced by the plugins.
+func (l *Library) stopUnusedRPCservers() error {
+	l.mtx.Lock()
+	used := make(map[string]struct{})
+	for _, v := range l.pim {
+		if validRPC(v) {
+			used[subprocKey(v.cfg.Plugin, v.cfg.Cmd)] = struct{}{}
+		}
+	}
+	var unused []subproc
+	kept := make([]subproc, 0, len(l.subprocs))
+	for _, s := range l.subprocs {
+		if _, ok := used[subprocKey(s.plugin, s.cmd)]; ok {
+			kept = append(kept, s)
+		} else {
+			unused = append(unused, s)
+		}
+	}
+	l.subprocs = kept
+	l.mtx.Unlock() // so that plugins can run while the servers are stopped
+	errStr := ""
+	for _, s := range unused {
+		if err := s.ecmd.Process.Kill(); err != nil {
+			errStr += " : " + err.Error()
+		}
+	}
+	if errStr == "" {
+		return nil
+	}
+	return errors.New(errStr)
+}
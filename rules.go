@@ -0,0 +1,138 @@
+package glick
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+)
+
+// Rule reroutes calls to an API, when set-up by RuleOverloader().
+// Rules are given in the Rules field of a Config entry for the API,
+// so that they can be changed alongside the rest of the configuration.
+type Rule struct {
+	Actions []string          // the actions the rule applies to, all the actions on the API if empty.
+	When    map[string]string // the named context values which must all match, see RuleOverloader().
+	To      string            // the action on the same API to run instead.
+	Plugin  string            // or the named plugin (the Plugin of its Config) on the same API to run instead.
+	Comment string            // a place to put comments about the rule.
+}
+
+// RuleOverloader sets the library to reroute calls according to the Rules in its configuration,
+// the keys map the names used in the When field of a Rule to the keys of context values.
+// The first Rule for an API which matches a call, and whose target exists, chooses the action run,
+// which then runs with its own policies, metrics and fallbacks, as if it had been called.
+// If no Rule matches, any Overloader given to New() is called.
+func RuleOverloader(keys map[string]interface{}) Option {
+	return func(l *Library) error {
+		l.ctxkeys = make(map[string]interface{}, len(keys))
+		for name, key := range keys {
+			if key == nil {
+				return errors.New("nil context key for rule name: " + name)
+			}
+			l.ctxkeys[name] = key
+		}
+		return nil
+	}
+}
+
+// addRules adds the Rules of a Config entry to those for its API, must be called with the library locked.
+func (l *Library) addRules(line int, cfg Config) error {
+	if l.ctxkeys == nil {
+		return fmt.Errorf("entry %d has rules, but there is no RuleOverloader", line)
+	}
+	if _, ok := l.apim[cfg.API]; !ok {
+		return fmt.Errorf("entry %d unknown api %s ", line, cfg.API)
+	}
+	for i, r := range cfg.Rules {
+		if (r.To == "") == (r.Plugin == "") {
+			return fmt.Errorf("entry %d rule %d must give one of To or Plugin", line, i+1)
+		}
+		for name := range r.When {
+			if _, ok := l.ctxkeys[name]; !ok {
+				return fmt.Errorf("entry %d rule %d unknown context name %s", line, i+1, name)
+			}
+		}
+	}
+	if l.rules == nil {
+		l.rules = make(map[string][]Rule)
+	}
+	l.rules[cfg.API] = append(l.rules[cfg.API], cfg.Rules...)
+	return nil
+}
+
+// reroute returns the call changed to run the target of the first Rule which matches it,
+// or unchanged if there is none.
+func (l *Library) reroute(ctx context.Context, c call) call {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	for _, r := range l.rules[c.api] {
+		if !r.matches(ctx, c.action, l.ctxkeys) {
+			continue
+		}
+		if action, pv, found := l.target(ctx, c.api, c.action, r); found {
+			c.action, c.pv, c.rerouted = action, pv, true
+			return c
+		}
+	}
+	return c
+}
+
+// matches returns true if the rule applies to the action and the values in the context.
+func (r Rule) matches(ctx context.Context, action string, keys map[string]interface{}) bool {
+	if len(r.Actions) > 0 {
+		found := false
+		for _, a := range r.Actions {
+			if a == action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for name, want := range r.When {
+		v := ctx.Value(keys[name])
+		if v == nil || fmt.Sprint(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// target returns the action and plugin a rule reroutes to, or false if it does not exist,
+// it must be called with the library read-locked.
+// A named plugin is looked for first among the plugins for the action, then those for the other actions on the API.
+func (l *Library) target(ctx context.Context, api, action string, r Rule) (string, plugval, bool) {
+	if r.To != "" {
+		pv, found := l.pim[plugkey{api, r.To}]
+		if !found || pv.plug == nil {
+			return "", plugval{}, false
+		}
+		return r.To, l.choose(ctx, api, r.To, pv), true
+	}
+	actions := []string{action}
+	for k := range l.pim {
+		if k.api == api && k.action != action {
+			actions = append(actions, k.action)
+		}
+	}
+	sort.Strings(actions[1:])
+	for _, a := range actions {
+		pv := l.pim[plugkey{api, a}]
+		for _, v := range pv.variants() {
+			if v.cfg != nil && v.cfg.Plugin == r.Plugin && v.plug != nil {
+				if len(v.fb.actions) == 0 {
+					v.fb = pv.fb
+				}
+				if v.shadow == nil {
+					v.shadow = pv.shadow
+				}
+				return a, v, true
+			}
+		}
+	}
+	return "", plugval{}, false
+}
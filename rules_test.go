@@ -0,0 +1,170 @@
+package glick_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+type tenantKey struct{}
+
+func TestRules(t *testing.T) {
+	if _, err := glick.New(nil, glick.RuleOverloader(map[string]interface{}{"bad": nil})); err == nil {
+		t.Error("nil context key not spotted")
+	}
+	l, nerr := glick.New(nil, glick.RuleOverloader(map[string]interface{}{"tenant": tenantKey{}}))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	outString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("rules", "", outString, time.Second); err != nil {
+		t.Error(err)
+	}
+	for _, bad := range []string{
+		`[{"API":"rules","Rules":[{"When":{"tenant":"acme"}}]}]`,
+		`[{"API":"rules","Rules":[{"To":"a","Plugin":"b"}]}]`,
+		`[{"API":"rules","Rules":[{"When":{"user":"acme"},"To":"b"}]}]`,
+		`[{"API":"nothere","Rules":[{"To":"b"}]}]`,
+	} {
+		if err := l.Configure([]byte(bad)); err == nil {
+			t.Error("bad rules not spotted: " + bad)
+		}
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"std","API":"rules","Actions":["a"],"Type":"CMD","Cmd":["echo","std"]},
+{"Plugin":"fast","API":"rules","Actions":["b"],"Type":"CMD","Cmd":["echo","fast"]},
+{"Plugin":"special","API":"rules","Actions":["c"],"Type":"CMD","Cmd":["echo","special"]},
+{"API":"rules","Rules":[
+	{"Actions":["a"],"When":{"tenant":"acme"},"Plugin":"special"},
+	{"Actions":["a"],"When":{"tenant":"acme"},"To":"b"},
+	{"When":{"tenant":"fast"},"To":"b"},
+	{"When":{"tenant":"gone"},"To":"nothere"}
+]}]`)); err != nil {
+		t.Error(err)
+		return
+	}
+	for _, c := range []struct {
+		tenant, action, want, served string
+		overloaded                   bool
+	}{
+		{"", "a", "std", "a", false},
+		{"acme", "a", "special", "c", true},
+		{"acme", "c", "special", "c", false},
+		{"fast", "a", "fast", "b", true},
+		{"fast", "c", "fast", "b", true},
+		{"gone", "a", "std", "a", false},
+	} {
+		ctx := context.Background()
+		if c.tenant != "" {
+			ctx = context.WithValue(ctx, tenantKey{}, c.tenant)
+		}
+		r := l.Call(ctx, "rules", c.action, "")
+		if r.Err != nil {
+			t.Error(r.Err)
+			continue
+		}
+		if got := *r.Out.(*string); got != c.want+"\n" {
+			t.Errorf("tenant %q action %s ran %q, wanted %s", c.tenant, c.action, got, c.want)
+		}
+		if r.Action != c.served {
+			t.Errorf("tenant %q action %s served by %s, wanted %s", c.tenant, c.action, r.Action, c.served)
+		}
+		if r.Overloaded != c.overloaded {
+			t.Errorf("tenant %q action %s overloaded %v", c.tenant, c.action, r.Overloaded)
+		}
+	}
+	if rs := l.State().APIs[0].Rules; len(rs) != 4 {
+		t.Errorf("state shows %d rules, wanted 4", len(rs))
+	}
+
+	// the rules for an API are replaced by a later configuration
+	if err := l.Configure([]byte(`[{"API":"rules","Rules":[{"When":{"tenant":"std"},"To":"a"}]}]`)); err != nil {
+		t.Error(err)
+	}
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	if out, err := l.Run(ctx, "rules", "a", ""); err != nil || *out.(*string) != "std\n" {
+		t.Error("old rules not replaced", err)
+	}
+}
+
+func TestRulesBreaker(t *testing.T) {
+	l, nerr := glick.New(nil, glick.RuleOverloader(nil))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("rules", 1, outTov, time.Second,
+		glick.Breaker(glick.BreakerPolicy{FailureRate: 0.5, MinCalls: 2})); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("rules", "good", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("rules", "bad", JustBad, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[{"API":"rules","Rules":[{"Actions":["good"],"To":"bad"}]}]`)); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 3; i++ {
+		if r := l.Call(nil, "rules", "good", 1); r.Err == nil || r.Action != "bad" {
+			t.Error("rerouted call did not fail in the target", r)
+		}
+	}
+	bs := l.Breakers()
+	if len(bs) != 1 || bs[0].Action != "bad" || bs[0].State != glick.BreakerOpen {
+		t.Errorf("rerouted failures not recorded against the target %#v", bs)
+	}
+	if s := l.Stats(); len(s) != 1 || s[0].Action != "bad" || !s[0].Overloaded || s[0].Calls != 3 {
+		t.Errorf("rerouted calls not recorded as overloaded against the target %#v", s)
+	}
+}
+
+func TestRulesNext(t *testing.T) {
+	hadOv := false
+	ov := func(ctx context.Context, api, action string, handler glick.Plugin) (context.Context, glick.Plugin, error) {
+		hadOv = true
+		return ctx, nil, nil
+	}
+	l, nerr := glick.New(ov, glick.RuleOverloader(nil))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("rules", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("rules", "true", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("rules", "false", Def, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[{"API":"rules","Rules":[{"Actions":["true"],"To":"false"}]}]`)); err != nil {
+		t.Error(err)
+	}
+	if out, err := l.Run(nil, "rules", "true", 1); err != nil || *out.(*bool) {
+		t.Error("rule not applied", err)
+	}
+	if hadOv {
+		t.Error("overloader called after a rule matched")
+	}
+	if _, err := l.Run(nil, "rules", "false", 1); err != nil {
+		t.Error(err)
+	}
+	if !hadOv {
+		t.Error("overloader not called when no rule matched")
+	}
+
+	nl, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := nl.RegAPI("rules", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := nl.Configure([]byte(`[{"API":"rules","Rules":[{"To":"false"}]}]`)); err == nil {
+		t.Error("rules without a RuleOverloader not spotted")
+	}
+}
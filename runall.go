@@ -0,0 +1,62 @@
+package glick
+
+import (
+	"errors"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Result holds the outcome of running one plugin.
+type Result struct {
+	Out        interface{}
+	Err        error
+	API        string // the api version that served the request, see VersionSep
+	Action     string // the action that served the request
+	Overloaded bool   // the overloader chose a different handler to the one registered for the action, or a Rule rerouted the call
+}
+
+// MaxParallel sets the maximum number of plugins that RunAll() runs at once,
+// the default is the number of CPUs.
+func MaxParallel(n int) Option {
+	return func(l *Library) error {
+		if n < 1 {
+			return errors.New("parallel limit must be at least 1")
+		}
+		l.parallel = n
+		return nil
+	}
+}
+
+// RunAll runs every action registered for an API concurrently, passing each the same data in,
+// returning the Result of each in a map by action name.
+// Each action is run as if by Run(), so within the API timeout.
+func (l *Library) RunAll(ctx context.Context, api string, in interface{}) (map[string]Result, error) {
+	actions, err := l.Actions(api)
+	if err != nil {
+		return nil, err
+	}
+	l.mtx.RLock()
+	parallel := l.parallel
+	l.mtx.RUnlock()
+	ret := make(map[string]Result, len(actions))
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	for _, action := range actions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(action string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r := l.Call(ctx, api, action, in)
+			mtx.Lock()
+			ret[action] = r
+			mtx.Unlock()
+		}(action)
+	}
+	wg.Wait()
+	return ret, nil
+}
@@ -0,0 +1,75 @@
+package glick_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestRunAll(t *testing.T) {
+	if _, err := glick.New(nil, glick.MaxParallel(0)); err == nil {
+		t.Error("zero parallel limit not spotted")
+	}
+	l, nerr := glick.New(nil, glick.MaxParallel(2))
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	if _, err := l.RunAll(nil, "abc", 1); err == nil {
+		t.Error("unknown api not spotted")
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, 100*time.Millisecond); err != nil {
+		t.Error(err)
+		return
+	}
+	var mtx sync.Mutex
+	running, most := 0, 0
+	counted := func(ctx context.Context, in interface{}) (interface{}, error) {
+		mtx.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mtx.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mtx.Lock()
+		running--
+		mtx.Unlock()
+		return Tov(ctx, in)
+	}
+	for _, act := range []string{"a", "b", "c", "d"} {
+		if err := l.RegPlugin("abc", act, counted, nil); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := l.RegPlugin("abc", "bad", JustBad, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "forever", Forever, nil); err != nil {
+		t.Error(err)
+	}
+	res, err := l.RunAll(nil, "abc", 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 6 {
+		t.Errorf("wrong number of results %d", len(res))
+	}
+	for _, act := range []string{"a", "b", "c", "d"} {
+		if res[act].Err != nil || !*res[act].Out.(*bool) {
+			t.Errorf("bad result for %s: %v", act, res[act])
+		}
+	}
+	if res["bad"].Err == nil || res["forever"].Err == nil {
+		t.Error("errors not returned")
+	}
+	if most > 2 {
+		t.Errorf("parallel limit exceeded, %d running", most)
+	}
+}
@@ -0,0 +1,199 @@
+package glick
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the JSON Schema draft used by Schema().
+const SchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is a JSON Schema document, or part of one, describing the JSON
+// encoding of a Go type; only the keywords needed to describe Go types are given.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Definitions          map[string]*JSONSchema `json:"definitions,omitempty"`
+}
+
+// APISchema gives the JSON Schema documents for the input and output of an API.
+type APISchema struct {
+	API     string
+	In, Out *JSONSchema
+}
+
+// Schema returns the JSON Schema documents for the input and output prototypes of an API,
+// describing their JSON encoding, as used by the "RPC" and "KIT" plugins.
+// Named struct types are given as definitions, pointers as the type they point to.
+// Fields which encode as null when nil, pointers, slices and maps without omitempty, may be either.
+func (l *Library) Schema(api string) (*APISchema, error) {
+	if l == nil {
+		return nil, ErrNilLib
+	}
+	l.mtx.RLock()
+	def, found := l.apim[api]
+	l.mtx.RUnlock()
+	if !found {
+		return nil, errNoAPI(api)
+	}
+	return &APISchema{API: api, In: schemaOf(def.ppiT, api+" in"), Out: schemaOf(def.ppoT, api+" out")}, nil
+}
+
+// Schemas returns the JSON Schema documents for every API, sorted by name.
+func (l *Library) Schemas() []APISchema {
+	if l == nil {
+		return nil
+	}
+	l.mtx.RLock()
+	apis := make([]string, 0, len(l.apim))
+	for api := range l.apim {
+		apis = append(apis, api)
+	}
+	l.mtx.RUnlock()
+	sort.Strings(apis)
+	ret := make([]APISchema, 0, len(apis))
+	for _, api := range apis {
+		if s, err := l.Schema(api); err == nil { // the api may have gone meanwhile
+			ret = append(ret, *s)
+		}
+	}
+	return ret
+}
+
+// schemaOf returns the root JSON Schema document for a type.
+func schemaOf(t reflect.Type, title string) *JSONSchema {
+	sb := schemaBuilder{defs: make(map[string]*JSONSchema), names: make(map[reflect.Type]string)}
+	s := sb.schema(t)
+	s.Schema, s.Title = SchemaVersion, title
+	if len(sb.defs) > 0 {
+		s.Definitions = sb.defs
+	}
+	return s
+}
+
+type schemaBuilder struct {
+	defs  map[string]*JSONSchema
+	names map[reflect.Type]string // the definition names of the named struct types
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (sb *schemaBuilder) schema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		return &JSONSchema{} // any value, as it encodes itself
+	case t.Implements(textType) || reflect.PtrTo(t).Implements(textType):
+		return &JSONSchema{Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &JSONSchema{Type: "array", Items: sb.schema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: sb.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sb.object(t)
+		}
+		name, found := sb.names[t]
+		if !found {
+			name = t.Name()
+			if _, taken := sb.defs[name]; taken {
+				name = strings.Replace(t.PkgPath(), "/", ".", -1) + "." + t.Name()
+			}
+			sb.names[t] = name
+			sb.defs[name] = &JSONSchema{} // so that recursive types refer to it
+			*sb.defs[name] = *sb.object(t)
+		}
+		return &JSONSchema{Ref: "#/definitions/" + name}
+	}
+	return &JSONSchema{} // any value, for interfaces and types JSON cannot encode
+}
+
+// object returns the schema for a struct, following the field rules of encoding/json.
+func (sb *schemaBuilder) object(t reflect.Type) *JSONSchema {
+	s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+	sb.fields(t, s)
+	sort.Strings(s.Required)
+	return s
+}
+
+func (sb *schemaBuilder) fields(t reflect.Type, s *JSONSchema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			sb.fields(ft, s) // the fields of embedded structs are promoted
+			continue
+		}
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := sb.schema(f.Type)
+		if strings.Contains(opts, ",string") {
+			fs = &JSONSchema{Type: "string"}
+		} else if nilable(f.Type) && !strings.Contains(opts, ",omitempty") && (fs.Type != "" || fs.Ref != "") {
+			fs = &JSONSchema{AnyOf: []*JSONSchema{fs, {Type: "null"}}}
+		}
+		s.Properties[name] = fs
+		if !strings.Contains(opts, ",omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// nilable returns true if a nil value of the type encodes as null.
+func nilable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
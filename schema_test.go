@@ -0,0 +1,71 @@
+package glick_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+	test "github.com/documize/glick/_test"
+)
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaNode struct {
+	schemaBase
+	Name     string
+	Doc      []byte            `json:"doc,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	When     time.Time
+	Children []*schemaNode
+	Any      interface{} `json:"-"`
+	hidden   int
+}
+
+func TestSchema(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if _, err := l.Schema("nothere"); err == nil {
+		t.Error("unknown api not spotted")
+	}
+	if err := l.RegAPI("node", schemaNode{}, func() interface{} { return &test.IntStr{} }, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegAPI("string", "", outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	s, err := l.Schema("node")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, err := json.Marshal(s.In)
+	if err != nil {
+		t.Error(err)
+	}
+	want := `{"$schema":"http://json-schema.org/draft-07/schema#","$ref":"#/definitions/schemaNode",` +
+		`"title":"node in","definitions":{"schemaNode":{"type":"object","properties":{` +
+		`"Children":{"anyOf":[{"type":"array","items":{"$ref":"#/definitions/schemaNode"}},{"type":"null"}]},` +
+		`"Name":{"type":"string"},"When":{"type":"string","format":"date-time"},` +
+		`"doc":{"type":"string","contentEncoding":"base64"},` +
+		`"id":{"type":"string"},"tags":{"type":"object","additionalProperties":{"type":"string"}}},` +
+		`"required":["Children","Name","When","id"]}}}`
+	if string(b) != want {
+		t.Errorf("unexpected schema:\n%s\nwanted:\n%s", b, want)
+	}
+	if s.Out.Ref != "#/definitions/IntStr" || s.Out.Definitions["IntStr"].Properties["I"].Type != "integer" {
+		t.Errorf("unexpected output schema %#v", s.Out)
+	}
+
+	all := l.Schemas()
+	if len(all) != 2 || all[0].API != "node" || all[1].API != "string" {
+		t.Errorf("unexpected schemas %#v", all)
+	}
+	if all[1].In.Type != "string" || all[1].Out.Type != "boolean" {
+		t.Errorf("unexpected string api schema %#v", all[1])
+	}
+}
@@ -0,0 +1,128 @@
+package glick
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ShadowPolicy describes another action on the same API to mirror calls to,
+// so that a new implementation can be tried with real traffic.
+type ShadowPolicy struct {
+	Action string   // the shadow action, run with the same input after the call.
+	Sample *float64 // the fraction of calls to mirror, between 0 and 1, all of them if not set.
+}
+
+func (sp *ShadowPolicy) validate() error {
+	if sp.Action == "" || (sp.Sample != nil && (*sp.Sample < 0 || *sp.Sample > 1)) {
+		return errors.New("shadow policy needs an action and a sample between 0 and 1")
+	}
+	return nil
+}
+
+func (sp *ShadowPolicy) sampled() bool {
+	return sp.Sample == nil || rand.Float64() < *sp.Sample
+}
+
+// defaultShadows is how many shadow calls may run at once, unless set by MaxShadows().
+const defaultShadows = 100
+
+// MaxShadows sets the most shadow calls that may run at once across the Library, the default is 100.
+// Calls are not mirrored while that many shadow calls are running.
+func MaxShadows(n int) Option {
+	return func(l *Library) error {
+		if n < 1 {
+			return errors.New("shadow limit must be at least 1")
+		}
+		l.shadows = make(chan struct{}, n)
+		return nil
+	}
+}
+
+// ShadowReport compares the result of a call with that of its shadow action.
+// The outputs are those returned to the caller, so must not be modified.
+type ShadowReport struct {
+	API, Action    string
+	Served         string // the action which served the call, which may be a fallback
+	Shadow         string // the shadow action
+	Out, ShadowOut interface{}
+	Err, ShadowErr error
+	Latency        time.Duration // how long the call took
+	ShadowLatency  time.Duration // how long the shadow action took
+	Match          bool          // the outputs and errors are the same, using reflect.DeepEqual
+}
+
+// Comparator is called with the report of each shadow call, from its own goroutine.
+type Comparator func(sr ShadowReport)
+
+// Compare sets the Comparator for the shadow calls of the library.
+func Compare(cmp Comparator) Option {
+	return func(l *Library) error {
+		if cmp == nil {
+			return errors.New("nil comparator")
+		}
+		l.compare = cmp
+		return nil
+	}
+}
+
+// RegShadow mirrors calls to an api/action to a shadow action on the same api.
+// This is the same as setting the Shadow field of the plugin Config.
+func (l *Library) RegShadow(api, action string, sp ShadowPolicy) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	if err := sp.validate(); err != nil {
+		return err
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	key := plugkey{api, action}
+	pv, found := l.pim[key]
+	if !found {
+		return errNoPlug(api + "/" + action)
+	}
+	pv.shadow = &sp
+	l.pim[key] = pv
+	return nil
+}
+
+// shadow runs the shadow action for a call in the background, then reports how it compares.
+// The shadow call keeps the values of the context, but not its cancellation, and its outcome
+// never affects the call. It is skipped if too many shadow calls are running,
+// and it is not held to the API and global concurrency limits, nor wrapped by the library and API Middleware,
+// so does not take the places of real calls or get counted as one by the Middleware.
+func (l *Library) shadow(ctx context.Context, c call, r Result, latency time.Duration) {
+	select {
+	case l.shadows <- struct{}{}:
+	default:
+		return
+	}
+	sp := c.pv.shadow
+	l.mtx.RLock()
+	pv, found := l.pim[plugkey{c.api, sp.Action}]
+	cmp := l.compare
+	l.mtx.RUnlock()
+	sc := c
+	sc.action, sc.pv, sc.overloaded, sc.rerouted, sc.shadow = sp.Action, l.choose(ctx, c.api, sp.Action, pv), false, false, true
+	sc.mws = nil
+	go func() {
+		defer func() { <-l.shadows }()
+		sr := ShadowReport{API: c.api, Action: c.action, Served: r.Action, Shadow: sp.Action,
+			Out: r.Out, Err: r.Err, Latency: latency}
+		start := time.Now()
+		if found {
+			sr.ShadowOut, sr.ShadowErr = l.attempt(detached{ctx}, sc, sc.pv.plug)
+		} else {
+			sr.ShadowErr = errNoPlug(c.api + "/" + sp.Action)
+		}
+		sr.ShadowLatency = time.Since(start)
+		sr.Match = reflect.DeepEqual(sr.Out, sr.ShadowOut) && reflect.DeepEqual(sr.Err, sr.ShadowErr)
+		if cmp != nil {
+			cmp(sr)
+		}
+	}()
+}
@@ -0,0 +1,194 @@
+package glick_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestShadow(t *testing.T) {
+	reports := make(chan glick.ShadowReport, 10)
+	l, nerr := glick.New(nil, glick.Compare(func(sr glick.ShadowReport) { reports <- sr }))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("shadow", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "old", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "same", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "differ", Def, nil); err != nil {
+		t.Error(err)
+	}
+	block := make(chan struct{})
+	if err := l.RegPlugin("shadow", "slowBad", func(ctx context.Context, in interface{}) (interface{}, error) {
+		<-block
+		return nil, errors.New("shadow failed")
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegShadow("shadow", "old", glick.ShadowPolicy{Action: "same", Sample: sample(2)}); err == nil {
+		t.Error("bad sample not spotted")
+	}
+	if err := l.RegShadow("shadow", "nothere", glick.ShadowPolicy{Action: "same"}); err == nil {
+		t.Error("shadow of unknown action not spotted")
+	}
+	for _, c := range []struct {
+		shadow string
+		match  bool
+	}{{"same", true}, {"differ", false}} {
+		if err := l.RegShadow("shadow", "old", glick.ShadowPolicy{Action: c.shadow}); err != nil {
+			t.Error(err)
+		}
+		if out, err := l.Run(nil, "shadow", "old", 1); err != nil || !*out.(*bool) {
+			t.Error("shadowed call failed", err)
+		}
+		sr := <-reports
+		if sr.Action != "old" || sr.Served != "old" || sr.Shadow != c.shadow || sr.Match != c.match {
+			t.Errorf("unexpected shadow report %#v", sr)
+		}
+	}
+
+	// a slow, failing shadow does not affect the call
+	if err := l.RegShadow("shadow", "old", glick.ShadowPolicy{Action: "slowBad"}); err != nil {
+		t.Error(err)
+	}
+	if out, err := l.Run(nil, "shadow", "old", 1); err != nil || !*out.(*bool) {
+		t.Error("shadowed call failed", err)
+	}
+	select {
+	case <-reports:
+		t.Error("shadow reported before it finished")
+	default:
+	}
+	close(block)
+	if sr := <-reports; sr.ShadowErr == nil || sr.Match {
+		t.Errorf("shadow error not reported %#v", sr)
+	}
+}
+
+// sample returns a pointer to the fraction of calls to mirror.
+func sample(f float64) *float64 { return &f }
+
+func TestShadowSample(t *testing.T) {
+	reports := make(chan glick.ShadowReport, 1000)
+	l, nerr := glick.New(nil, glick.Compare(func(sr glick.ShadowReport) { reports <- sr }))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("shadow", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "new", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "old", Tov, &glick.Config{
+		Shadow: &glick.ShadowPolicy{Action: "new", Sample: sample(0.1)},
+	}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "none", Tov, &glick.Config{
+		Shadow: &glick.ShadowPolicy{Action: "new", Sample: sample(0)},
+	}); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, err := l.Run(nil, "shadow", "old", 1); err != nil {
+			t.Error(err)
+		}
+		if _, err := l.Run(nil, "shadow", "none", 1); err != nil {
+			t.Error(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(reports); n < 50 || n > 150 {
+		t.Errorf("%d of 1000 calls shadowed, wanted about 100", n)
+	}
+}
+
+func TestShadowLoad(t *testing.T) {
+	if _, err := glick.New(nil, glick.MaxShadows(0)); err == nil {
+		t.Error("zero shadow limit not spotted")
+	}
+	reports := make(chan glick.ShadowReport, 10)
+	l, nerr := glick.New(nil, glick.GlobalLimit(1), glick.MaxShadows(1),
+		glick.Compare(func(sr glick.ShadowReport) { reports <- sr }))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("shadow", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	block := make(chan struct{})
+	if err := l.RegPlugin("shadow", "slow", func(ctx context.Context, in interface{}) (interface{}, error) {
+		<-block
+		return Tov(ctx, in)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "old", Tov, &glick.Config{
+		Shadow: &glick.ShadowPolicy{Action: "slow"},
+	}); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 3; i++ { // the running shadow call holds no place in the global limit
+		if _, err := l.Run(nil, "shadow", "old", 1); err != nil {
+			t.Error(err)
+		}
+	}
+	close(block)
+	if sr := <-reports; !sr.Match {
+		t.Errorf("unexpected shadow report %#v", sr)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(reports); n != 0 {
+		t.Errorf("%d shadow calls over the limit were run", n)
+	}
+}
+
+func TestShadowMiddleware(t *testing.T) {
+	reports := make(chan glick.ShadowReport, 1)
+	l, nerr := glick.New(nil, glick.Compare(func(sr glick.ShadowReport) { reports <- sr }))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("shadow", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	var seen []string
+	count := func(api, action string, handler glick.Plugin) glick.Plugin {
+		return func(ctx context.Context, in interface{}) (interface{}, error) {
+			seen = append(seen, action)
+			return handler(ctx, in)
+		}
+	}
+	if err := l.Use(count); err != nil {
+		t.Error(err)
+	}
+	if err := l.UseAPI("shadow", count); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "new", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("shadow", "old", Tov, &glick.Config{
+		Shadow: &glick.ShadowPolicy{Action: "new"},
+	}); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "shadow", "old", 1); err != nil {
+		t.Error(err)
+	}
+	<-reports
+	if len(seen) != 2 || seen[0] != "old" || seen[1] != "old" {
+		t.Errorf("middleware saw %v, wanted only the call to old", seen)
+	}
+}
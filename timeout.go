@@ -0,0 +1,35 @@
+package glick
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type timeoutKey struct{}
+
+// WithPluginTimeout returns a context for which Run() uses the given timeout for the plugin,
+// in place of the timeout of its Config or API; it may be longer or shorter, zero for no limit,
+// or negative for a call which times-out without the plugin being run.
+// It does not set a deadline on the context, any deadline of the context itself still applies.
+func WithPluginTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// timeout returns the time a call to a plugin may take, zero for no limit, or negative if it must not run:
+// that set for the call by WithPluginTimeout(), or else that of the plugin Config, or else that of the API.
+func (c call) timeout(ctx context.Context) time.Duration {
+	if t, found := ctx.Value(timeoutKey{}).(time.Duration); found {
+		return t
+	}
+	if c.pv.timeout > 0 {
+		return c.pv.timeout
+	}
+	if c.def.timeout > 0 {
+		return c.def.timeout
+	}
+	return 0
+}
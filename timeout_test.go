@@ -0,0 +1,76 @@
+package glick_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+// sleeper returns a plugin which takes the given time, unless its context is done first.
+func sleeper(d time.Duration) glick.Plugin {
+	return func(ctx context.Context, in interface{}) (interface{}, error) {
+		select {
+		case <-time.After(d):
+			return Tov(ctx, in)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestActionTimeout(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("timeout", 1, outTov, 20*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegAPI("nolimit", 1, outTov, 0); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("timeout", "bad", Tov, &glick.Config{Timeout: -1}); err == nil {
+		t.Error("negative timeout not spotted")
+	}
+	if err := l.RegPlugin("timeout", "api", sleeper(50*time.Millisecond), nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("timeout", "long", sleeper(50*time.Millisecond),
+		&glick.Config{Timeout: glick.Duration(time.Second)}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("timeout", "short", sleeper(10*time.Millisecond),
+		&glick.Config{Timeout: glick.Duration(time.Millisecond)}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("nolimit", "slow", sleeper(50*time.Millisecond), nil); err != nil {
+		t.Error(err)
+	}
+	bg := context.Background()
+	for _, c := range []struct {
+		ctx         context.Context
+		api, action string
+		ok          bool
+	}{
+		{bg, "timeout", "api", false},
+		{bg, "timeout", "long", true},
+		{bg, "timeout", "short", false},
+		{bg, "nolimit", "slow", true},
+		{glick.WithPluginTimeout(bg, time.Second), "timeout", "api", true},
+		{glick.WithPluginTimeout(bg, 0), "timeout", "api", true},
+		{glick.WithPluginTimeout(bg, time.Millisecond), "timeout", "long", false},
+		{glick.WithPluginTimeout(bg, time.Millisecond), "nolimit", "slow", false},
+		{glick.WithPluginTimeout(bg, -1), "nolimit", "slow", false},
+	} {
+		_, err := l.Run(c.ctx, c.api, c.action, 1)
+		if c.ok && err != nil {
+			t.Errorf("%s %s: %v", c.api, c.action, err)
+		}
+		if !c.ok && !glick.IsErrClass(err, glick.ErrClassTimeout) {
+			t.Errorf("%s %s did not time-out: %v", c.api, c.action, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package glick
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TraceParentHeader is the W3C Trace Context HTTP header which carries the traceparent.
+const TraceParentHeader = "traceparent"
+
+// TraceParentEnv is the environment variable which carries the traceparent to "CMD" plugins.
+const TraceParentEnv = "TRACEPARENT"
+
+// Span describes one call to a plugin by Run(), in W3C Trace Context terms.
+type Span struct {
+	TraceID, SpanID, ParentID string // in hex, ParentID is empty for the root of a trace
+	API, Action               string // the api/action asked for
+	Served                    string // the action which served the call, which may be a fallback
+	Overloaded                bool   // the overloader chose a different handler to the one registered
+	Start                     time.Time
+	Duration                  time.Duration
+	Err                       error
+}
+
+// Tracer is called with the Span for each call to a plugin by Run(), when it finishes.
+type Tracer func(span Span)
+
+// Trace sets a Tracer for the library, so that a span is started for every call to a plugin,
+// even if the context does not carry a traceparent.
+func Trace(t Tracer) Option {
+	return func(l *Library) error {
+		if t == nil {
+			return errors.New("nil tracer")
+		}
+		l.tracer = t
+		return nil
+	}
+}
+
+type traceKey struct{}
+
+// WithTraceParent returns a context carrying a W3C traceparent,
+// for example taken from the header of an incoming HTTP request.
+// When the context is passed to Run(), a child span is started for the call to the plugin,
+// and the traceparent of that span is passed on by the built-in plugins.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceparent)
+}
+
+// TraceParent returns the W3C traceparent carried by the context, or "" if there is none.
+func TraceParent(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tp, _ := ctx.Value(traceKey{}).(string)
+	return tp
+}
+
+// parseTraceParent splits a version 00 traceparent into its trace-id, parent-id and flags.
+func parseTraceParent(tp string) (traceID, parentID, flags string, ok bool) {
+	bits := strings.Split(tp, "-")
+	if len(bits) != 4 || bits[0] != "00" ||
+		len(bits[1]) != 32 || len(bits[2]) != 16 || len(bits[3]) != 2 {
+		return "", "", "", false
+	}
+	for _, b := range bits[1:] {
+		if _, err := hex.DecodeString(b); err != nil {
+			return "", "", "", false
+		}
+	}
+	return bits[1], bits[2], bits[3], true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Repeat("0", 2*n-1) + "1" // crypto/rand should not fail
+	}
+	return hex.EncodeToString(b)
+}
+
+// startSpan returns a context carrying the traceparent of a new span for a call,
+// if the context carries a traceparent or the library has a Tracer,
+// and a function to finish the span with the Result of the call.
+func (l *Library) startSpan(ctx context.Context, api, action string) (context.Context, func(Result)) {
+	traceID, parentID, flags, ok := parseTraceParent(TraceParent(ctx))
+	if !ok {
+		if l.tracer == nil {
+			return ctx, func(Result) {}
+		}
+		traceID, parentID, flags = randomHex(16), "", "01"
+	}
+	span := Span{TraceID: traceID, SpanID: randomHex(8), ParentID: parentID,
+		API: api, Action: action, Start: time.Now()}
+	ctx = WithTraceParent(ctx, "00-"+traceID+"-"+span.SpanID+"-"+flags)
+	return ctx, func(r Result) {
+		if l.tracer != nil {
+			span.Served, span.Overloaded, span.Err = r.Action, r.Overloaded, r.Err
+			span.Duration = time.Since(span.Start)
+			l.tracer(span)
+		}
+	}
+}
+
+// TraceEnvelope returns a copy of a struct, or pointer to a struct, with its string field
+// named TraceParent set to the traceparent carried by the context.
+// It is used to pass the trace context to "RPC" plugins, other values are returned unchanged.
+func TraceEnvelope(ctx context.Context, in interface{}) interface{} {
+	tp := TraceParent(ctx)
+	if tp == "" || in == nil {
+		return in
+	}
+	v := reflect.ValueOf(in)
+	isPtr := v.Kind() == reflect.Ptr
+	if isPtr {
+		if v.IsNil() {
+			return in
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return in
+	}
+	f, found := v.Type().FieldByName("TraceParent")
+	if !found || f.Type.Kind() != reflect.String || f.PkgPath != "" {
+		return in
+	}
+	cp := reflect.New(v.Type())
+	cp.Elem().Set(v)
+	fv := cp.Elem()
+	for _, i := range f.Index[:len(f.Index)-1] { // through the embedded structs
+		fv = fv.Field(i)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() || !fv.CanSet() {
+				return in
+			}
+			ep := reflect.New(fv.Type().Elem()) // so that the embedded struct of the caller is not changed
+			ep.Elem().Set(fv.Elem())
+			fv.Set(ep)
+			fv = ep.Elem()
+		}
+	}
+	if fv = fv.Field(f.Index[len(f.Index)-1]); !fv.CanSet() {
+		return in // promoted through an unexported embedded struct
+	}
+	fv.SetString(tp)
+	if isPtr {
+		return cp.Interface()
+	}
+	return cp.Elem().Interface()
+}
@@ -0,0 +1,196 @@
+package glick_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+	test "github.com/documize/glick/_test"
+
+	"golang.org/x/net/context"
+)
+
+const testParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func TestTrace(t *testing.T) {
+	if _, err := glick.New(nil, glick.Trace(nil)); err == nil {
+		t.Error("nil tracer not spotted")
+	}
+	var mtx sync.Mutex
+	var spans []glick.Span
+	l, nerr := glick.New(func(ctx context.Context, api, act string, handler glick.Plugin) (context.Context, glick.Plugin, error) {
+		if act == "ov" {
+			return ctx, Tov, nil
+		}
+		return ctx, nil, nil
+	}, glick.Trace(func(s glick.Span) {
+		mtx.Lock()
+		spans = append(spans, s)
+		mtx.Unlock()
+	}))
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	var prototype int
+	if err := l.RegAPI("abc", prototype, outTov, time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	var seen string
+	if err := l.RegPlugin("abc", "seen", func(ctx context.Context, in interface{}) (interface{}, error) {
+		seen = glick.TraceParent(ctx)
+		return Tov(ctx, in)
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "bad", JustBad, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("abc", "ov", Def, nil); err != nil {
+		t.Error(err)
+	}
+	ctx := glick.WithTraceParent(context.Background(), testParent)
+	if _, err := l.Run(ctx, "abc", "seen", 1); err != nil {
+		t.Error(err)
+	}
+	if !strings.HasPrefix(seen, "00-0af7651916cd43dd8448eb211c80319c-") ||
+		seen == testParent || !strings.HasSuffix(seen, "-01") {
+		t.Error("child traceparent not passed to plugin", seen)
+	}
+	if _, err := l.Run(nil, "abc", "bad", 1); err == nil {
+		t.Error("bad plugin did not error")
+	}
+	if _, err := l.Run(nil, "abc", "ov", 1); err != nil {
+		t.Error(err)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(spans) != 3 {
+		t.Errorf("wrong spans %#v", spans)
+		return
+	}
+	if s := spans[0]; s.ParentID != "b7ad6b7169203331" || s.API != "abc" || s.Action != "seen" ||
+		s.Served != "seen" || s.Err != nil || !strings.Contains(seen, s.SpanID) {
+		t.Errorf("wrong child span %#v", s)
+	}
+	if s := spans[1]; s.ParentID != "" || len(s.TraceID) != 32 || s.Err == nil {
+		t.Errorf("wrong root span %#v", s)
+	}
+	if s := spans[2]; !s.Overloaded {
+		t.Errorf("overload not traced %#v", s)
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+		return
+	}
+	ctx := glick.WithTraceParent(context.Background(), testParent)
+	traceID := "0af7651916cd43dd8448eb211c80319c"
+
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("string/*string", "env",
+		glick.PluginCmd([]string{"printenv", glick.TraceParentEnv}, &protoString), nil); err != nil {
+		t.Error(err)
+	}
+	if out, err := l.Run(ctx, "string/*string", "env", ""); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(*out.(*string), traceID) {
+		t.Error("traceparent not passed to command", *out.(*string))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(glick.TraceParentHeader)))
+	}))
+	defer srv.Close()
+	if err := l.RegPlugin("string/*string", "url",
+		glick.PluginGetURL(true, srv.URL, &protoString), nil); err != nil {
+		t.Error(err)
+	}
+	if out, err := l.Run(ctx, "string/*string", "url", ""); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(*out.(*string), traceID) {
+		t.Error("traceparent not passed in URL header", *out.(*string))
+	}
+
+	server := rpc.NewServer()
+	if err := server.Register(&test.CI{}); err != nil {
+		t.Error(err)
+		return
+	}
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer listener.Close()
+	go server.Accept(listener)
+	tsOut := func() interface{} { return &test.TraceStr{} }
+	if err := l.RegAPI("trace", test.TraceStr{}, tsOut, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("trace", "rpc",
+		glick.PluginRPC(false, "CI.EchoTrace",
+			"localhost:"+strings.Split(listener.Addr().String(), ":")[1], tsOut), nil); err != nil {
+		t.Error(err)
+	}
+	if out, err := l.Run(ctx, "trace", "rpc", test.TraceStr{}); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(out.(*test.TraceStr).TraceParent, traceID) {
+		t.Error("traceparent not passed in RPC envelope", out.(*test.TraceStr).TraceParent)
+	}
+	if out, err := l.Run(nil, "trace", "rpc", test.TraceStr{}); err != nil {
+		t.Error(err)
+	} else if out.(*test.TraceStr).TraceParent != "" {
+		t.Error("traceparent passed without a trace", out.(*test.TraceStr).TraceParent)
+	}
+}
+
+type traceMeta struct {
+	TraceParent string
+}
+
+type traceEmbed struct {
+	*traceMeta
+	N int
+}
+
+type TraceMeta struct {
+	TraceParent string
+}
+
+type traceExported struct {
+	*TraceMeta
+}
+
+func TestTraceEnvelope(t *testing.T) {
+	ctx := glick.WithTraceParent(context.Background(), testParent)
+	if out := glick.TraceEnvelope(ctx, traceExported{}).(traceExported); out.TraceMeta != nil {
+		t.Error("nil embedded pointer changed", out)
+	}
+	meta := &TraceMeta{}
+	out := glick.TraceEnvelope(ctx, traceExported{meta}).(traceExported)
+	if !strings.Contains(out.TraceParent, "0af7651916cd43dd8448eb211c80319c") {
+		t.Error("traceparent not set through embedded pointer", out.TraceParent)
+	}
+	if meta.TraceParent != "" {
+		t.Error("embedded struct of the caller changed", meta.TraceParent)
+	}
+	in := traceEmbed{&traceMeta{}, 1}
+	if out := glick.TraceEnvelope(ctx, in).(traceEmbed); out.traceMeta.TraceParent != "" {
+		t.Error("traceparent set through unexported embedded pointer", out.traceMeta.TraceParent)
+	}
+}
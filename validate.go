@@ -0,0 +1,145 @@
+package glick
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Validator checks the input to, or output from, a plugin.
+// It should return an error from Invalid() to name the field at fault.
+type Validator func(v interface{}) error
+
+// ValidationError is returned when the input to, or the output from, a plugin is not valid.
+type ValidationError struct {
+	API, Action string
+	Output      bool   // it was the output of the plugin which was not valid
+	Field       string // the field at fault, if known
+	Reason      string
+}
+
+func (e *ValidationError) Error() string {
+	what := "input"
+	if e.Output {
+		what = "output"
+	}
+	if e.Field != "" {
+		what += " field " + e.Field
+	}
+	return fmt.Sprintf("invalid %s for api %s action %s: %s", what, e.API, e.Action, e.Reason)
+}
+
+// Invalid returns an error for a Validator to say why a field is not valid.
+func Invalid(field, reason string) error {
+	return &ValidationError{Field: field, Reason: reason}
+}
+
+// ValidateIn adds Validators for the input of every call to an API, run before the plugin.
+func ValidateIn(vs ...Validator) APIOption {
+	return func(def *apidef) error {
+		for _, v := range vs {
+			if v == nil {
+				return errors.New("nil validator")
+			}
+		}
+		def.inVal = append(def.inVal, vs...)
+		return nil
+	}
+}
+
+// ValidateOut adds Validators for the output of every successful call to the plugins of an API,
+// an output which is not valid is not returned to the caller.
+func ValidateOut(vs ...Validator) APIOption {
+	return func(def *apidef) error {
+		for _, v := range vs {
+			if v == nil {
+				return errors.New("nil validator")
+			}
+		}
+		def.outVal = append(def.outVal, vs...)
+		return nil
+	}
+}
+
+// validate runs the Validators on a value, returning the first error as a ValidationError.
+func validate(vs []Validator, api, action string, output bool, v interface{}) error {
+	for _, fn := range vs {
+		err := fn(v)
+		if err == nil {
+			continue
+		}
+		ve := &ValidationError{Reason: err.Error()}
+		var fe *ValidationError
+		if errors.As(err, &fe) {
+			*ve = *fe
+		}
+		ve.API, ve.Action, ve.Output = api, action, output
+		return ve
+	}
+	return nil
+}
+
+// field returns the named field of a struct, or pointer to one.
+func field(v interface{}, name string) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, Invalid(name, fmt.Sprintf("%T is not a struct", v))
+	}
+	f := rv.FieldByName(name)
+	if !f.IsValid() {
+		return reflect.Value{}, Invalid(name, "no such field")
+	}
+	return f, nil
+}
+
+// Required returns a Validator that checks a struct field is not the zero value.
+func Required(name string) Validator {
+	return func(v interface{}) error {
+		f, err := field(v, name)
+		if err != nil {
+			return err
+		}
+		if f.IsZero() {
+			return Invalid(name, "required")
+		}
+		return nil
+	}
+}
+
+// MaxLen returns a Validator that checks the length of a string, slice or map struct field.
+func MaxLen(name string, n int) Validator {
+	return func(v interface{}) error {
+		f, err := field(v, name)
+		if err != nil {
+			return err
+		}
+		switch f.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			if f.Len() > n {
+				return Invalid(name, fmt.Sprintf("length %d over the limit of %d", f.Len(), n))
+			}
+			return nil
+		}
+		return Invalid(name, "has no length")
+	}
+}
+
+// OneOf returns a Validator that checks a struct field, formatted with fmt.Sprint, is one of the values given.
+func OneOf(name string, values ...string) Validator {
+	return func(v interface{}) error {
+		f, err := field(v, name)
+		if err != nil {
+			return err
+		}
+		s := fmt.Sprint(f.Interface())
+		for _, val := range values {
+			if s == val {
+				return nil
+			}
+		}
+		return Invalid(name, fmt.Sprintf("%q is not one of %q", s, values))
+	}
+}
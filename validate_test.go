@@ -0,0 +1,82 @@
+package glick_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+type valDoc struct {
+	Name string
+	Kind string
+	Doc  []byte
+}
+
+func TestValidate(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	outDoc := func() interface{} { return &valDoc{} }
+	if err := l.RegAPI("bad", valDoc{}, outDoc, time.Second, glick.ValidateIn(nil)); err == nil {
+		t.Error("nil validator not spotted")
+	}
+	if err := l.RegAPI("val", valDoc{}, outDoc, time.Second,
+		glick.ValidateIn(glick.Required("Name"), glick.MaxLen("Doc", 4), glick.OneOf("Kind", "pdf", "doc")),
+		glick.ValidateOut(glick.Required("Doc"), func(v interface{}) error {
+			if v.(*valDoc).Name == "plain" {
+				return errors.New("plain error")
+			}
+			return nil
+		})); err != nil {
+		t.Error(err)
+	}
+	calls := 0
+	if err := l.RegPlugin("val", "echo", func(ctx context.Context, in interface{}) (interface{}, error) {
+		calls++
+		d := in.(valDoc)
+		return &d, nil
+	}, nil); err != nil {
+		t.Error(err)
+	}
+	for _, c := range []struct {
+		in     valDoc
+		output bool
+		field  string
+	}{
+		{valDoc{Name: "a", Kind: "pdf", Doc: []byte("1")}, false, ""},
+		{valDoc{Kind: "pdf", Doc: []byte("1")}, false, "Name"},
+		{valDoc{Name: "a", Kind: "pdf", Doc: []byte("12345")}, false, "Doc"},
+		{valDoc{Name: "a", Kind: "txt", Doc: []byte("1")}, false, "Kind"},
+		{valDoc{Name: "a", Kind: "pdf"}, true, "Doc"},
+		{valDoc{Name: "plain", Kind: "pdf", Doc: []byte("1")}, true, ""},
+	} {
+		calls = 0
+		out, err := l.Run(nil, "val", "echo", c.in)
+		if c.field == "" && !c.output {
+			if err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+		var ve *glick.ValidationError
+		if !errors.As(err, &ve) {
+			t.Errorf("no validation error for %#v: %v", c.in, err)
+			continue
+		}
+		if out != nil || ve.API != "val" || ve.Action != "echo" || ve.Output != c.output || ve.Field != c.field {
+			t.Errorf("unexpected validation error for %#v: %#v", c.in, ve)
+		}
+		if (calls == 1) != c.output {
+			t.Errorf("plugin called %d times for %#v", calls, c.in)
+		}
+	}
+	if _, err := l.Run(nil, "val", "echo", valDoc{Name: "plain", Kind: "pdf", Doc: []byte("1")}); err == nil ||
+		err.Error() != "invalid output for api val action echo: plain error" {
+		t.Error("unexpected error", err)
+	}
+}
@@ -0,0 +1,150 @@
+package glick
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionSep separates the name of an API from its version, as in "convert@2".
+// When looking up an API, the version may instead be a constraint: "convert@>=2",
+// "convert@<3", or "convert" for any version.
+const VersionSep = "@"
+
+// Compatible declares that the plugins for the given versions of an API can
+// serve calls to this version, if there is no plugin for the action on this version.
+// The input of a call must still be assignable to the input type of the version which serves it.
+func Compatible(versions ...int) APIOption {
+	return func(def *apidef) error {
+		def.compat = append(def.compat, versions...)
+		return nil
+	}
+}
+
+// constraint matches the versions of an API.
+type constraint struct {
+	op string // one of "", "=", ">=", "<=", ">", "<"; "" matches any version
+	n  int
+}
+
+func (c constraint) matches(v int) bool {
+	switch c.op {
+	case "=":
+		return v == c.n
+	case ">=":
+		return v >= c.n
+	case "<=":
+		return v <= c.n
+	case ">":
+		return v > c.n
+	case "<":
+		return v < c.n
+	}
+	return true
+}
+
+// splitVersion splits the name of an API from its version constraint.
+func splitVersion(api string) (string, constraint, error) {
+	i := strings.LastIndex(api, VersionSep)
+	if i < 0 {
+		return api, constraint{}, nil
+	}
+	name, s := api[:i], api[i+len(VersionSep):]
+	c := constraint{op: "="}
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(s, op) {
+			c.op, s = op, s[len(op):]
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || name == "" {
+		return "", constraint{}, errors.New("bad api version: " + api)
+	}
+	c.n = n
+	return name, c, nil
+}
+
+// checkVersion returns an error if an API name to register has a version which is not a number.
+func checkVersion(api string, def apidef) error {
+	_, c, err := splitVersion(api)
+	if err != nil {
+		return err
+	}
+	if c.op != "" && c.op != "=" {
+		return errors.New("api version must be a number: " + api)
+	}
+	if len(def.compat) > 0 && c.op == "" {
+		return errors.New("compatible versions given for unversioned api: " + api)
+	}
+	return nil
+}
+
+// versions returns the registered versions of an API matching the constraint, highest first.
+// It must be called with the library read-locked.
+func (l *Library) versions(name string, c constraint) []int {
+	var vs []int
+	for api := range l.apim {
+		n, ac, err := splitVersion(api)
+		if err == nil && n == name && ac.op == "=" && c.matches(ac.n) {
+			vs = append(vs, ac.n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(vs)))
+	return vs
+}
+
+func versioned(name string, v int) string {
+	return name + VersionSep + strconv.Itoa(v)
+}
+
+// resolveAPI returns the registered API which best matches an API name or version constraint,
+// the highest version matching; it must be called with the library read-locked.
+func (l *Library) resolveAPI(api string) (string, bool) {
+	if _, found := l.apim[api]; found {
+		return api, true
+	}
+	name, c, err := splitVersion(api)
+	if err != nil {
+		return api, false
+	}
+	if vs := l.versions(name, c); len(vs) > 0 {
+		return versioned(name, vs[0]), true
+	}
+	return api, false
+}
+
+// resolve returns the registered API version to serve a call, it must be called with the library read-locked.
+// A call to an exact version is served by that version, or else by the highest version it is
+// Compatible with that has a plugin for the action. Otherwise the call is served by the highest
+// version matching the constraint that has a plugin for the action and takes the input given.
+// If none does, the API is returned as given.
+func (l *Library) resolve(api, action string, in interface{}) string {
+	if _, found := l.pim[plugkey{api, action}]; found {
+		return api
+	}
+	name, c, err := splitVersion(api)
+	if err != nil {
+		return api
+	}
+	var vs []int
+	if c.op == "=" {
+		vs = append(vs, l.apim[api].compat...)
+		sort.Sort(sort.Reverse(sort.IntSlice(vs)))
+	} else {
+		vs = l.versions(name, c)
+	}
+	for _, v := range vs {
+		try := versioned(name, v)
+		def, found := l.apim[try]
+		if !found || in == nil || !reflect.TypeOf(in).AssignableTo(def.ppiT) {
+			continue
+		}
+		if _, found := l.pim[plugkey{try, action}]; found {
+			return try
+		}
+	}
+	return api
+}
@@ -0,0 +1,103 @@
+package glick_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+	test "github.com/documize/glick/_test"
+
+	"golang.org/x/net/context"
+)
+
+func TestVersion(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	for _, bad := range []string{"convert@", "convert@x", "convert@>=2", "@2"} {
+		if err := l.RegAPI(bad, 1, outTov, time.Second); err == nil {
+			t.Error("bad version not spotted: " + bad)
+		}
+	}
+	if err := l.RegAPI("convert", 1, outTov, time.Second, glick.Compatible(1)); err == nil {
+		t.Error("compatible versions for an unversioned api not spotted")
+	}
+	if err := l.RegAPI("convert@1", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegAPI("convert@2", 1, outTov, time.Second, glick.Compatible(1)); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegAPI("convert@3", test.IntStr{}, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("convert@1", "old", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("convert@1", "both", Def, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("convert@2", "both", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("convert@3", "both", Tov, nil); err != nil {
+		t.Error(err)
+	}
+	for _, c := range []struct {
+		api, action string
+		in          interface{}
+		want        string // the version which should serve the call, "" for an error
+	}{
+		{"convert@1", "old", 1, "convert@1"},
+		{"convert@2", "old", 1, "convert@1"}, // compatible
+		{"convert@3", "old", test.IntStr{}, ""},
+		{"convert@2", "both", 1, "convert@2"},
+		{"convert", "both", 1, "convert@2"}, // convert@3 takes another input type
+		{"convert", "both", test.IntStr{}, "convert@3"},
+		{"convert@<2", "both", 1, "convert@1"},
+		{"convert@>=2", "old", 1, ""},
+		{"convert@>=4", "both", 1, ""},
+	} {
+		r := l.Call(context.Background(), c.api, c.action, c.in)
+		if c.want == "" {
+			if r.Err == nil {
+				t.Errorf("%s %s did not error", c.api, c.action)
+			}
+			continue
+		}
+		if r.Err != nil || r.API != c.want {
+			t.Errorf("%s %s served by %q, wanted %s: %v", c.api, c.action, r.API, c.want, r.Err)
+		}
+	}
+}
+
+func TestVersionConfig(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	outString := func() interface{} { var s string; return interface{}(&s) }
+	for _, api := range []string{"convert@1", "convert@2"} {
+		if err := l.RegAPI(api, "", outString, time.Second); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"a","API":"convert@<2","Actions":["a"],"Type":"CMD","Cmd":["echo","a"]},
+{"Plugin":"b","API":"convert","Actions":["b"],"Type":"CMD","Cmd":["echo","b"]}
+]`)); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "convert@1", "a", ""); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.Run(nil, "convert@2", "b", ""); err != nil {
+		t.Error(err)
+	}
+	if err := l.Configure([]byte(`[
+{"Plugin":"c","API":"convert@>2","Actions":["c"],"Type":"CMD","Cmd":["echo","c"]}
+]`)); err == nil {
+		t.Error("unmatched version constraint not spotted")
+	}
+}
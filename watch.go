@@ -0,0 +1,83 @@
+package glick
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// ConfigureFile reads a JSON configuration file and configures the plugins
+// for a library from it, in the same way as Configure().
+func (l *Library) ConfigureFile(path string) error {
+	if l == nil {
+		return ErrNilLib
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return l.Configure(b)
+}
+
+// WatchConfig reconfigures the library from a JSON configuration file,
+// then polls the file at the given interval (default one second) and
+// calls Reconfigure() whenever its contents change.
+// A new version of the file is only applied if every entry in it is valid,
+// otherwise the working configuration is kept and the error passed to report (which may be nil).
+// The returned function stops the polling.
+func (l *Library) WatchConfig(path string, interval time.Duration, report func(error)) (stop func(), err error) {
+	if l == nil {
+		return nil, ErrNilLib
+	}
+	last, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = l.Reconfigure(last); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	go l.watch(path, interval, report, sha256.Sum256(last), done)
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// watch polls the configuration file until done is closed, comparing a hash of its
+// contents each time, as the modification time may not change for a quick edit.
+func (l *Library) watch(path string, interval time.Duration, report func(error), last [sha256.Size]byte, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastErr := "" // so that a missing or unreadable file is only reported once
+	fail := func(err error, repeat bool) {
+		if report != nil && (repeat || err.Error() != lastErr) {
+			report(fmt.Errorf("config file %s: %v", path, err))
+		}
+		lastErr = err.Error()
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			fail(err, false)
+			continue
+		}
+		lastErr = ""
+		sum := sha256.Sum256(b)
+		if sum == last {
+			continue
+		}
+		last = sum
+		if err := l.Reconfigure(b); err != nil {
+			fail(err, true)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package glick_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+)
+
+func TestConfigureFile(t *testing.T) {
+	l, ne := glick.New(nil)
+	if ne != nil {
+		t.Error(ne)
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	dir, err := ioutil.TempDir("", "glick")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := l.ConfigureFile(path); err == nil {
+		t.Error("missing file did not error")
+	}
+	if err := ioutil.WriteFile(path, []byte(`[
+{"Plugin":"p1","API":"string/*string","Actions":["pwd"],"Type":"CMD","Cmd":["pwd"]}
+		]`), 0600); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := l.ConfigureFile(path); err != nil {
+		t.Error(err)
+	}
+	if acts, _ := l.Actions("string/*string"); len(acts) != 1 || acts[0] != "pwd" {
+		t.Errorf("file configuration not applied, got %v", acts)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	l, ne := glick.New(nil)
+	if ne != nil {
+		t.Error(ne)
+	}
+	protoString := ""
+	outProtoString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("string/*string", protoString, outProtoString, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+	dir, err := ioutil.TempDir("", "glick")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	write := func(s string) {
+		if err := ioutil.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Error(err)
+		}
+	}
+	actions := func() []string {
+		acts, _ := l.Actions("string/*string")
+		return acts
+	}
+	write(`[{"Plugin":"p1","API":"string/*string","Actions":["one"],"Type":"CMD","Cmd":["pwd"]}]`)
+	reports := make(chan error, 10)
+	stop, err := l.WatchConfig(path, 10*time.Millisecond, func(e error) { reports <- e })
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer stop()
+	if acts := actions(); len(acts) != 1 || acts[0] != "one" {
+		t.Errorf("initial configuration not applied, got %v", acts)
+	}
+	write(`[{"Plugin":"p2","API":"string/*string","Actions":["two"],"Type":"CMD","Cmd":["pwd"]}]`)
+	for i := 0; i < 100; i++ {
+		if acts := actions(); len(acts) == 1 && acts[0] == "two" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if acts := actions(); len(acts) != 1 || acts[0] != "two" {
+		t.Errorf("changed configuration not applied, got %v", acts)
+	}
+	// an edit of the same size and modification time is still spotted
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Error(err)
+	}
+	write(`[{"Plugin":"p2","API":"string/*string","Actions":["owt"],"Type":"CMD","Cmd":["pwd"]}]`)
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 100; i++ {
+		if acts := actions(); len(acts) == 1 && acts[0] == "owt" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if acts := actions(); len(acts) != 1 || acts[0] != "owt" {
+		t.Errorf("same size configuration not applied, got %v", acts)
+	}
+	write(`[{"Plugin":"p3","API":"string/*string","Actions":["three"],"Type":"CMD","Cmd":["garbage"]}]  `)
+	select {
+	case <-reports:
+	case <-time.After(2 * time.Second):
+		t.Error("bad configuration not reported")
+	}
+	if acts := actions(); len(acts) != 1 || acts[0] != "owt" {
+		t.Errorf("bad configuration applied, got %v", acts)
+	}
+	stop()
+	stop() // second stop should do nothing
+	if _, err := l.WatchConfig(filepath.Join(dir, "missing.json"), 0, nil); err == nil {
+		t.Error("missing file did not error")
+	}
+}
@@ -0,0 +1,103 @@
+package glick
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand"
+
+	"golang.org/x/net/context"
+)
+
+// errWeight means that the weight of a plugin is invalid.
+var errWeight = errors.New("plugin weight must not be negative")
+
+// Sticky sets the function which gives a key from the context, such as a user ID,
+// used to choose between weighted plugins for an action.
+// Calls with the same key go to the same plugin while the weights are unchanged,
+// calls without a key, or if there is no Sticky function, are routed at random.
+func Sticky(fn func(ctx context.Context) string) Option {
+	return func(l *Library) error {
+		if fn == nil {
+			return errors.New("nil sticky function")
+		}
+		l.sticky = fn
+		return nil
+	}
+}
+
+// variants returns the weighted plugins backing an api/action.
+func (pv plugval) variants() []plugval {
+	if len(pv.weighted) > 0 {
+		return pv.weighted
+	}
+	return []plugval{pv}
+}
+
+// weigh adds a plugin with a Weight to those already backing an api/action,
+// unless the plugin is not weighted, or replaces one which is not.
+// When staging a configuration, the first plugin for an api/action replaces those from before.
+// It must be called with the library locked.
+func (l *Library) weigh(key plugkey, pv plugval) plugval {
+	old, found := l.pim[key]
+	if !found || pv.weight == 0 || old.weight == 0 {
+		return pv
+	}
+	if l.touched != nil {
+		if _, seen := l.touched[key]; !seen {
+			return pv
+		}
+	}
+	vs := append([]plugval{}, old.variants()...)
+	pv.variant = len(vs)
+	pv.weighted = append(vs, pv)
+	return pv
+}
+
+// choose picks the plugin to run from the healthy weighted plugins backing an api/action,
+// or from all of them if none are healthy,
+// it keeps the fallback and shadow actions of the api/action if the plugin chosen has none.
+func (l *Library) choose(ctx context.Context, api, action string, pv plugval) plugval {
+	if len(pv.weighted) == 0 {
+		return pv
+	}
+	vs := make([]plugval, 0, len(pv.weighted))
+	for _, v := range pv.weighted {
+		if l.healthy(api, action, v.variant) == nil {
+			vs = append(vs, v)
+		}
+	}
+	if len(vs) == 0 {
+		vs = pv.weighted
+	}
+	total := 0
+	for _, v := range vs {
+		total += v.weight
+	}
+	var n int
+	key := ""
+	if l.sticky != nil {
+		key = l.sticky(ctx)
+	}
+	if key != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key)) // never returns an error
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rand.Intn(total)
+	}
+	chosen := vs[len(vs)-1]
+	for _, v := range vs {
+		if n < v.weight {
+			chosen = v
+			break
+		}
+		n -= v.weight
+	}
+	if len(chosen.fb.actions) == 0 {
+		chosen.fb = pv.fb
+	}
+	if chosen.shadow == nil {
+		chosen.shadow = pv.shadow
+	}
+	return chosen
+}
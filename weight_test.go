@@ -0,0 +1,180 @@
+package glick_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/documize/glick"
+
+	"golang.org/x/net/context"
+)
+
+func TestWeight(t *testing.T) {
+	l, nerr := glick.New(nil, glick.Sticky(func(ctx context.Context) string {
+		user, _ := ctx.Value(userKey{}).(string)
+		return user
+	}))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("weight", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("weight", "act", Tov, &glick.Config{Weight: -1}); err == nil {
+		t.Error("negative weight not spotted")
+	}
+	if err := l.RegPlugin("weight", "act", Tov, &glick.Config{Weight: 3}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("weight", "act", Def, &glick.Config{Weight: 1}); err != nil {
+		t.Error(err)
+	}
+	count := func(ctx context.Context, n int) (trues int) {
+		for i := 0; i < n; i++ {
+			out, err := l.Run(ctx, "weight", "act", 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if *out.(*bool) {
+				trues++
+			}
+		}
+		return trues
+	}
+	if trues := count(nil, 1000); trues < 650 || trues > 850 {
+		t.Errorf("weighted routing gave %d of 1000 calls to the 3/4 plugin", trues)
+	}
+	for _, user := range []string{"alice", "bob", "carol"} {
+		ctx := context.WithValue(context.Background(), userKey{}, user)
+		if trues := count(ctx, 20); trues != 0 && trues != 20 {
+			t.Errorf("sticky routing for %s split %d/20", user, trues)
+		}
+	}
+	if cfg := l.State().APIs[0].Actions[0]; len(cfg.Weighted) != 2 {
+		t.Errorf("state shows %d weighted plugins, wanted 2", len(cfg.Weighted))
+	}
+
+	// an unweighted plugin replaces the weighted ones
+	if err := l.RegPlugin("weight", "act", Def, nil); err != nil {
+		t.Error(err)
+	}
+	if trues := count(nil, 100); trues != 0 {
+		t.Errorf("replaced weighted plugin served %d calls", trues)
+	}
+}
+
+func TestWeightConfig(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	outString := func() interface{} { var s string; return interface{}(&s) }
+	if err := l.RegAPI("weight", "", outString, time.Second); err != nil {
+		t.Error(err)
+	}
+	cfg := []byte(`[
+{"Plugin":"stable","API":"weight","Actions":["act"],"Type":"CMD","Cmd":["echo","stable"],"Weight":95},
+{"Plugin":"canary","API":"weight","Actions":["act"],"Type":"CMD","Cmd":["echo","canary"],"Weight":5}
+]`)
+	for i := 0; i < 2; i++ { // configuring twice replaces, rather than adds to, the weighted plugins
+		if err := l.Reconfigure(cfg); err != nil {
+			t.Error(err)
+		}
+	}
+	if cfg := l.State().APIs[0].Actions[0]; len(cfg.Weighted) != 2 {
+		t.Errorf("state shows %d weighted plugins, wanted 2", len(cfg.Weighted))
+	}
+	canary := 0
+	for i := 0; i < 200; i++ {
+		out, err := l.Run(nil, "weight", "act", "")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if *out.(*string) == "canary\n" {
+			canary++
+		}
+	}
+	if canary == 0 || canary > 40 {
+		t.Errorf("canary served %d of 200 calls", canary)
+	}
+}
+
+func TestWeightHealth(t *testing.T) {
+	l, nerr := glick.New(nil)
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("weight", 1, outTov, time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("weight", "act", Tov, &glick.Config{Weight: 1}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegProbe("weight", "act", func(ctx context.Context) error { return nil }); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("weight", "act", Def, &glick.Config{Weight: 1}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegProbe("weight", "act", func(ctx context.Context) error { return errors.New("down") }); err != nil {
+		t.Error(err)
+	}
+	hr := l.Health(nil)
+	if len(hr) != 2 || hr[0].Variant != 0 || !hr[0].Healthy ||
+		hr[1].Variant != 1 || hr[1].Healthy || hr[1].Error != "down" {
+		t.Errorf("wrong health report %#v", hr)
+	}
+	for i := 0; i < 100; i++ {
+		out, err := l.Run(nil, "weight", "act", 1)
+		if err != nil {
+			t.Error("healthy weighted plugin not chosen", err)
+			return
+		}
+		if !*out.(*bool) {
+			t.Error("unhealthy weighted plugin chosen")
+			return
+		}
+	}
+}
+
+func TestWeightCanary(t *testing.T) {
+	l, nerr := glick.New(nil, glick.Quarantine(glick.QuarantinePolicy{
+		Panics: 1, Window: glick.Duration(time.Hour)}))
+	if nerr != nil {
+		t.Error(nerr)
+	}
+	if err := l.RegAPI("weight", 1, outTov, time.Second,
+		glick.Breaker(glick.BreakerPolicy{FailureRate: 0.5, MinCalls: 1,
+			OpenFor: glick.Duration(time.Hour)})); err != nil {
+		t.Error(err)
+	}
+	for _, act := range []string{"bad", "panic"} {
+		if err := l.RegPlugin("weight", act, Tov, &glick.Config{Weight: 19}); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := l.RegPlugin("weight", "bad", JustBad, &glick.Config{Weight: 1}); err != nil {
+		t.Error(err)
+	}
+	if err := l.RegPlugin("weight", "panic", Panic, &glick.Config{Weight: 1}); err != nil {
+		t.Error(err)
+	}
+	for _, act := range []string{"bad", "panic"} {
+		served := 0
+		for i := 0; i < 200; i++ {
+			if _, err := l.Run(nil, "weight", act, 1); err == nil {
+				served++
+			}
+		}
+		if served < 150 {
+			t.Errorf("failing canary for %s stopped the stable plugin, %d of 200 calls served", act, served)
+		}
+	}
+	if bs := l.Breakers(); len(bs) < 2 || bs[0].Action != "bad" || bs[0].Variant != 0 || bs[0].State != glick.BreakerClosed ||
+		bs[1].Action != "bad" || bs[1].Variant != 1 || bs[1].State != glick.BreakerOpen {
+		t.Errorf("wrong breaker states %#v", bs)
+	}
+}